@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"templar/internal/options"
+	"templar/internal/secrets"
 	"templar/internal/tome"
 	"templar/internal/values"
 )
@@ -23,8 +25,13 @@ func main() {
 	}
 
 	args := options.Args
+	if len(args) == 3 && args[0] == "values" && args[1] == "init" {
+		valuesInit(args[2])
+	}
+
 	if options.ShowHelp || len(args) != 1 {
 		fmt.Println("Usage: templar [flags] <input dir/file>")
+		fmt.Println("       templar [-o file] values init <input dir>")
 		options.PrintDefaults()
 		if len(args) < 1 {
 			os.Exit(1)
@@ -32,15 +39,29 @@ func main() {
 		os.Exit(0)
 	}
 
-	values, err := values.LoadAndMerge(options.Values, options.SetValues)
+	values.SetSensitiveKeys(options.SensitiveKeys)
+	loadOptions := values.LoadOptions{NoEnvSubst: options.NoEnvSubst, AgeKeyFile: options.AgeKeyFile}
+	vals, err := values.LoadAndMerge(options.Values, options.SetValues,
+		options.SetStringValues, options.SetFileValues, options.SetJSONValues, loadOptions)
 	if err != nil {
-		fmt.Printf("[templar] ❌  failed to load values: %v\n", err)
+		fmt.Printf("[templar] ❌  failed to load values: %v\n", redact(err))
 		os.Exit(1)
 	}
 
+	var schema *values.Schema
+	if options.Schema != "" {
+		schema, err = values.LoadSchema(options.Schema)
+		if err != nil {
+			fmt.Printf("[templar] ❌  failed to load schema: %v\n", redact(err))
+			os.Exit(1)
+		}
+		schema.ApplyDefaults(vals)
+		schema.MarkSensitive(vals)
+	}
+
 	info, err := os.Stat(args[0])
 	if err != nil {
-		fmt.Printf("[templar] ❌  failed to access input path: %v\n", err)
+		fmt.Printf("[templar] ❌  failed to access input path: %v\n", redact(err))
 		os.Exit(1)
 	}
 
@@ -53,39 +74,87 @@ func main() {
 		options.ExcludePatterns,
 		options.CopyPatterns,
 		options.TempPatterns,
-		values,
+		vals,
 	)
 
 	if err != nil {
-		fmt.Printf("[templar] ❌  failed to create base tome: %v\n", err)
+		fmt.Printf("[templar] ❌  failed to create base tome: %v\n", redact(err))
 		os.Exit(1)
 	}
-
+	baseTome.Schema = schema
+	if err := tome.ValidateDelims(options.Delims); err != nil {
+		fmt.Printf("[templar] ❌  %v\n", err)
+		os.Exit(1)
+	}
+	baseTome.Delims = options.Delims
+	baseTome.ValidateOutput = options.ValidateOutput
+	root := baseTome.Source
 	if !info.IsDir() {
-		content, err := os.ReadFile(args[0])
+		root = filepath.Dir(root)
+	}
+	baseTome.Roots = append([]string{root}, options.AllowRoots...)
+	baseTome.Secrets = secrets.NewResolver()
+	baseTome.Secrets.SetLoadOptions(loadOptions)
+	if options.SecretsFile != "" {
+		baseTome.Secrets.Register("file", secrets.NewFileProvider(options.SecretsFile, loadOptions))
+		baseTome.Secrets.SetDefault("file")
+	}
+
+	if options.PluginsFile != "" {
+		plugins, err := tome.LoadPluginsFile(options.PluginsFile)
+		if err == nil {
+			err = baseTome.AddPlugins(plugins...)
+		}
 		if err != nil {
-			fmt.Printf("[templar] ❌  failed to read input file: %v\n", err)
+			fmt.Printf("[templar] ❌  %v\n", redact(err))
+			os.Exit(1)
+		}
+	}
+
+	if options.RenderValues {
+		if err := baseTome.RenderValues(); err != nil {
+			fmt.Printf("[templar] ❌  %v\n", redact(err))
 			os.Exit(1)
 		}
+	}
+
+	// Values are validated as templates see them, after rendering
+	if schema != nil {
+		if err := schema.Validate(baseTome.Values); err != nil {
+			fmt.Printf("[templar] ❌  %v\n", redact(err))
+			os.Exit(1)
+		}
+	}
 
+	if !info.IsDir() {
 		writer := os.Stdout
 		if options.Out != "" {
 			writer, err = os.Create(options.Out)
 			if err != nil {
-				fmt.Printf("[templar] ❌  failed to create output file: %v\n", err)
+				fmt.Printf("[templar] ❌  failed to create output file: %v\n", redact(err))
 				os.Exit(1)
 			}
 			defer writer.Close()
 		}
 
-		err = baseTome.Template(writer, string(content), args[0])
+		err = baseTome.RenderFile(writer, args[0], options.Out)
 		if err != nil {
-			fmt.Printf("[templar] ❌  error templating file: %v\n", err)
+			fmt.Printf("[templar] ❌  error templating file: %v\n", redact(err))
+			os.Exit(1)
+		}
+		if err := tome.SaveGenerated(); err != nil {
+			fmt.Printf("[templar] ❌  %v\n", redact(err))
 			os.Exit(1)
 		}
+		tome.ClosePlugins()
 		os.Exit(0)
 	}
 
+	if err := baseTome.LoadPartials(nil); err != nil {
+		fmt.Printf("[templar] ❌  %v\n", redact(err))
+		os.Exit(1)
+	}
+
 	if options.Verbose {
 		b, _ := json.MarshalIndent(baseTome, "", "  ")
 		fmt.Printf("[templar] Tome %s\n", string(b))
@@ -93,10 +162,44 @@ func main() {
 
 	err = baseTome.Render(args[0])
 	if err != nil {
-		fmt.Printf("[templar] ❌  error walking files: %v\n", err)
+		fmt.Printf("[templar] ❌  error walking files: %v\n", redact(err))
 		os.Exit(1)
 	}
+	if err := tome.SaveGenerated(); err != nil {
+		fmt.Printf("[templar] ❌  %v\n", redact(err))
+		os.Exit(1)
+	}
+	tome.ClosePlugins()
 
 	fmt.Println("[templar] ✅  Template rendering complete.")
 	os.Exit(0)
 }
+
+// redact returns the error message with all sensitive values removed.
+func redact(err error) string {
+	return values.RedactString(err.Error())
+}
+
+// valuesInit prints (or writes to --out) a values skeleton for the templates in dir.
+func valuesInit(dir string) {
+	skeleton, err := tome.ValuesSkeleton(dir, options.StripSuffix, options.IncludePatterns, options.ExcludePatterns,
+		options.CopyPatterns, options.TempPatterns, options.Delims)
+	if err != nil {
+		fmt.Printf("[templar] ❌  failed to generate values skeleton: %v\n", redact(err))
+		os.Exit(1)
+	}
+
+	if options.Out == "" {
+		fmt.Print(skeleton)
+		os.Exit(0)
+	}
+	if _, err := os.Stat(options.Out); err == nil && !options.Force {
+		fmt.Printf("[templar] ❌  %s already exists, use --force to overwrite\n", options.Out)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(options.Out, []byte(skeleton), 0644); err != nil {
+		fmt.Printf("[templar] ❌  failed to write values skeleton: %v\n", redact(err))
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
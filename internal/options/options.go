@@ -2,6 +2,7 @@ package options
 
 import (
 	"fmt"
+	"time"
 
 	flag "github.com/spf13/pflag"
 )
@@ -13,16 +14,38 @@ var (
 	ShowVersion     bool
 	ShowHelp        bool
 	Strict          bool
+	NoEnvSubst      bool
+	NoNetwork       bool
+	Sandbox         bool
+	RenderValues    bool
+	ScriptRead      bool
+	ValidateOutput  bool
 	Mode            string
 	Out             string
+	Schema          string
+	AgeKeyFile      string
+	SecretsFile     string
+	Seed            string
+	StateFile       string
+	PluginsFile     string
+	HTTPCacheDir    string
+	HTTPTimeout     time.Duration
+	HTTPMaxSize     int64
+	AllowHosts      []string
+	AllowRoots      []string
 	Args            []string
 	StripSuffix     []string
 	Values          []string
 	SetValues       []string
+	SetStringValues []string
+	SetFileValues   []string
+	SetJSONValues   []string
 	IncludePatterns []string
 	ExcludePatterns []string
 	CopyPatterns    []string
 	TempPatterns    []string
+	SensitiveKeys   []string
+	Delims          []string
 )
 
 type multiFlag []string
@@ -36,15 +59,37 @@ func Init() {
 	flag.BoolVarP(&DryRun, "dry-run", "d", false, "Simulate actions without writing files")
 	flag.BoolVarP(&Verbose, "verbose", "D", false, "Enable verbose logging")
 	flag.BoolVarP(&Strict, "strict", "S", false, "Fail on missing values")
+	flag.BoolVar(&RenderValues, "render-values", false, "Render templates in values with the values themselves until no value changes")
+	flag.BoolVar(&ValidateOutput, "validate-output", false, "Fail if a generated .yaml, .json or .toml file cannot be parsed")
+	flag.BoolVar(&ScriptRead, "script-read", false, "Allow Starlark scripts to load other scripts and read files with read_file")
+	flag.BoolVar(&NoEnvSubst, "no-env", false, "Disable ${VAR} environment variable substitution in values files")
+	flag.BoolVar(&NoNetwork, "no-network", false, "Disallow fetching included URLs (cached content is still used)")
+	flag.StringSliceVar(&AllowHosts, "allow-host", []string{}, "Host (glob) that included URLs may be fetched from (can be repeated; default: all)")
+	flag.DurationVar(&HTTPTimeout, "http-timeout", 30*time.Second, "Timeout for fetching included URLs")
+	flag.Int64Var(&HTTPMaxSize, "http-max-size", 10<<20, "Maximum size in bytes of an included URL")
+	flag.StringVar(&HTTPCacheDir, "http-cache", "", "Directory to cache included URLs in")
+	flag.BoolVar(&Sandbox, "sandbox", false, "Confine file access from templates to the input directory and --allow-root directories")
+	flag.StringSliceVar(&AllowRoots, "allow-root", []string{}, "Additional directory templates may read files from with --sandbox (can be repeated)")
 	flag.BoolVarP(&Force, "force", "F", false, "Overwrite files in output directory without confirmation")
 	flag.StringVarP(&Mode, "mode", "m", "", "Set file mode (permissions) for created files (octal or symbolic)")
 	flag.StringVarP(&Out, "out", "o", "", "Output directory for generated files (default: standard output)")
+	flag.StringVar(&Schema, "schema", "", "Path to a JSON Schema file to validate values against")
+	flag.StringVar(&AgeKeyFile, "age-key-file", "", "Path to an age identity file used to decrypt encrypted values files")
+	flag.StringVar(&SecretsFile, "secrets-file", "", "Path to a (possibly encrypted) values file used as the default source for the secret function")
+	flag.StringVar(&Seed, "seed", "", "Seed for reproducible output of the generator functions (genPassword, genUUID, ...)")
+	flag.StringVar(&StateFile, "state-file", "", "File to persist generated passwords, keys and certificates in, so reruns reuse them")
+	flag.StringSliceVar(&Delims, "delims", []string{}, "Left and right template delimiters, e.g. '[[,]]' (default: '{{,}}')")
+	flag.StringVar(&PluginsFile, "plugins", "", "Path to a YAML file declaring plugins that provide template functions")
 	flag.StringSliceVarP(&Values, "values", "v", []string{}, "Path to values YAML file (can be repeated)")
 	flag.StringSliceVarP(&SetValues, "set", "s", []string{}, "Set a value (key=value) (can be repeated)")
+	flag.StringArrayVar(&SetStringValues, "set-string", []string{}, "Set a string value (key=value) without type conversion (can be repeated)")
+	flag.StringArrayVar(&SetFileValues, "set-file", []string{}, "Set a value to the contents of a file (key=path) (can be repeated)")
+	flag.StringArrayVar(&SetJSONValues, "set-json", []string{}, "Set a value from a JSON document (key=json) (can be repeated)")
 	flag.StringSliceVarP(&IncludePatterns, "include", "i", []string{}, "Glob pattern of files to include (can be repeated)")
 	flag.StringSliceVarP(&ExcludePatterns, "exclude", "e", []string{}, "Glob pattern of files to exclude (can be repeated)")
 	flag.StringSliceVarP(&CopyPatterns, "copy", "c", []string{}, "Glob pattern for files to copy without templating (can be repeated)")
 	flag.StringSliceVarP(&TempPatterns, "temp", "t", []string{}, "Glob pattern for files to template; others are copied as-is (mutually exclusive with --copy)")
+	flag.StringSliceVar(&SensitiveKeys, "sensitive-key", []string{}, "Glob pattern of value keys to redact from logs, e.g. '*_pin' (can be repeated)")
 	flag.StringSliceVarP(&StripSuffix, "strip", "r", []string{}, "Suffix to strip from output filenames if templated (can be repeated)")
 
 	flag.Parse()
@@ -0,0 +1,28 @@
+package options
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitKeepsCommasInSetValues(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"templar",
+		"--set-string", "tags=a,b",
+		"--set-file", "certs=ca,1.pem",
+		"--set-json", `ports=[80,443]`,
+		"--set", "a=1,b=2",
+		"input",
+	}
+
+	Init()
+
+	assert.Equal(t, []string{"tags=a,b"}, SetStringValues)
+	assert.Equal(t, []string{"certs=ca,1.pem"}, SetFileValues)
+	assert.Equal(t, []string{"ports=[80,443]"}, SetJSONValues)
+	assert.Equal(t, []string{"a=1", "b=2"}, SetValues)
+	assert.Equal(t, []string{"input"}, Args)
+}
@@ -0,0 +1,132 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"templar/internal/values"
+)
+
+// execTimeout bounds how long an exec provider command may run.
+const execTimeout = 30 * time.Second
+
+// envProvider resolves references to environment variables. Slashes in a
+// reference become underscores and the optional prefix is prepended, e.g.
+// "DB/PASSWORD" with prefix "APP_" reads $APP_DB_PASSWORD.
+type envProvider struct {
+	prefix string
+}
+
+func newEnvProvider(config ProviderConfig, dir string) (Provider, error) {
+	return &envProvider{prefix: config.Prefix}, nil
+}
+
+func (p *envProvider) Resolve(ref string) (string, error) {
+	name := p.prefix + strings.ReplaceAll(ref, "/", "_")
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// fileProvider resolves "path/to/key" references against a values file,
+// which may be encrypted with age or SOPS.
+type fileProvider struct {
+	path string
+	load values.LoadOptions
+	once sync.Once
+	data map[string]any
+	err  error
+}
+
+func newFileProvider(config ProviderConfig, dir string) (Provider, error) {
+	if config.Path == "" {
+		return nil, errors.New("file provider requires a path")
+	}
+	path := config.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return &fileProvider{path: path, load: config.load}, nil
+}
+
+// NewFileProvider returns a provider reading secrets from the values file at
+// path, loaded with opts.
+func NewFileProvider(path string, opts values.LoadOptions) Provider {
+	return &fileProvider{path: path, load: opts}
+}
+
+func (p *fileProvider) Resolve(ref string) (string, error) {
+	p.once.Do(func() {
+		p.data, p.err = values.LoadAndMerge([]string{p.path}, nil, nil, nil, nil, p.load)
+		if p.err == nil {
+			// Everything in a secrets file is sensitive, encrypted or not
+			values.MarkSensitive(p.data)
+		}
+	})
+	if p.err != nil {
+		return "", p.err
+	}
+
+	var current any = p.data
+	for _, key := range strings.Split(strings.Trim(ref, "/"), "/") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("no secret %s in %s", ref, p.path)
+		}
+		if current, ok = m[key]; !ok {
+			return "", fmt.Errorf("no secret %s in %s", ref, p.path)
+		}
+	}
+	switch current.(type) {
+	case map[string]any, []any, nil:
+		return "", fmt.Errorf("secret %s in %s is not a scalar value", ref, p.path)
+	}
+	return fmt.Sprint(current), nil
+}
+
+// execProvider resolves references by running a command with the reference
+// as its last argument and reading the secret from its standard output.
+type execProvider struct {
+	command []string
+}
+
+func newExecProvider(config ProviderConfig, dir string) (Provider, error) {
+	if len(config.Command) == 0 {
+		return nil, errors.New("exec provider requires a command")
+	}
+	return &execProvider{command: config.Command}, nil
+}
+
+func (p *execProvider) Resolve(ref string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	args := append(append([]string{}, p.command[1:]...), ref)
+	cmd := exec.CommandContext(ctx, p.command[0], args...)
+	cmd.Env = append(os.Environ(), "TEMPLAR_SECRET_REF="+ref)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// stderr may echo the secret, so it is redacted before reporting
+		msg := strings.TrimSpace(values.RedactString(stderr.String()))
+		if secret := strings.TrimSpace(stdout.String()); secret != "" {
+			msg = strings.ReplaceAll(msg, secret, values.Redacted)
+		}
+		if msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", p.command[0], err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", p.command[0], err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,178 @@
+// Package secrets resolves secret references for the `secret` template
+// function through pluggable providers.
+package secrets
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"templar/internal/values"
+)
+
+// Provider resolves a reference such as "db/password" to a secret value.
+type Provider interface {
+	Resolve(ref string) (string, error)
+}
+
+// ProviderFunc adapts a function to the Provider interface.
+type ProviderFunc func(ref string) (string, error)
+
+func (f ProviderFunc) Resolve(ref string) (string, error) { return f(ref) }
+
+// Factory creates a provider from its configuration. dir is the directory
+// relative paths in the configuration are resolved against.
+type Factory func(config ProviderConfig, dir string) (Provider, error)
+
+// ProviderConfig configures a single named provider.
+type ProviderConfig struct {
+	Type    string   `yaml:"type" json:"type"`
+	Path    string   `yaml:"path" json:"path,omitempty"`
+	Command []string `yaml:"command" json:"command,omitempty"`
+	Prefix  string   `yaml:"prefix" json:"prefix,omitempty"`
+
+	// load is how a file provider loads its values file, set by the resolver
+	load values.LoadOptions
+}
+
+// Config is the `secrets` property of a tome.
+type Config struct {
+	Default   string                    `yaml:"default" json:"default,omitempty"`
+	Providers map[string]ProviderConfig `yaml:"providers" json:"providers,omitempty"`
+}
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// RegisterType makes a provider type available to tome configurations.
+// It is intended for library users adding their own secret backends.
+func RegisterType(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = factory
+}
+
+func init() {
+	RegisterType("env", newEnvProvider)
+	RegisterType("file", newFileProvider)
+	RegisterType("exec", newExecProvider)
+}
+
+// Resolver dispatches secret references to named providers and caches the
+// results for the lifetime of a render.
+type Resolver struct {
+	mu          sync.Mutex
+	providers   map[string]Provider
+	defaultName string
+	cache       map[string]string
+	load        values.LoadOptions
+}
+
+// NewResolver returns a resolver with the built-in "env" provider as default.
+func NewResolver() *Resolver {
+	return &Resolver{
+		providers:   map[string]Provider{"env": &envProvider{}},
+		defaultName: "env",
+		cache:       map[string]string{},
+	}
+}
+
+// Register adds or replaces a named provider.
+func (r *Resolver) Register(name string, provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[name] = provider
+}
+
+// SetLoadOptions sets how file providers configured with With load their
+// values files.
+func (r *Resolver) SetLoadOptions(opts values.LoadOptions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.load = opts
+}
+
+// SetDefault selects the provider used for references without a provider prefix.
+func (r *Resolver) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.providers[name]; !ok {
+		return fmt.Errorf("unknown secret provider %q", name)
+	}
+	r.defaultName = name
+	return nil
+}
+
+// With returns a new resolver inheriting r's providers, extended with the
+// providers of config. Relative paths in config are resolved against dir.
+func (r *Resolver) With(config Config, dir string) (*Resolver, error) {
+	r.mu.Lock()
+	child := &Resolver{
+		providers:   make(map[string]Provider, len(r.providers)+len(config.Providers)),
+		defaultName: r.defaultName,
+		cache:       map[string]string{},
+		load:        r.load,
+	}
+	for name, provider := range r.providers {
+		child.providers[name] = provider
+	}
+	r.mu.Unlock()
+
+	names := make([]string, 0, len(config.Providers))
+	for name := range config.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		providerConfig := config.Providers[name]
+		providerConfig.load = child.load
+		factoriesMu.RLock()
+		factory, ok := factories[providerConfig.Type]
+		factoriesMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q for secret provider %q", providerConfig.Type, name)
+		}
+		provider, err := factory(providerConfig, dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret provider %q: %w", name, err)
+		}
+		child.providers[name] = provider
+	}
+
+	if config.Default != "" {
+		if err := child.SetDefault(config.Default); err != nil {
+			return nil, err
+		}
+	}
+	return child, nil
+}
+
+// Resolve looks up a reference. A reference may name its provider with a
+// prefix ("vault:db/password"), otherwise the default provider is used.
+// Resolved values are cached and marked sensitive.
+func (r *Resolver) Resolve(ref string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	providerName, key := r.defaultName, ref
+	if name, rest, ok := strings.Cut(ref, ":"); ok {
+		if _, known := r.providers[name]; known {
+			providerName, key = name, rest
+		}
+	}
+	cacheKey := providerName + ":" + key
+	if value, ok := r.cache[cacheKey]; ok {
+		return value, nil
+	}
+
+	value, err := r.providers[providerName].Resolve(key)
+	if err != nil {
+		return "", fmt.Errorf("secret %q from provider %q: %w", key, providerName, err)
+	}
+	values.MarkSensitive(value)
+	r.cache[cacheKey] = value
+	return value, nil
+}
@@ -0,0 +1,153 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"templar/internal/values"
+)
+
+func TestResolverEnvDefault(t *testing.T) {
+	t.Setenv("DB_PASSWORD", "env-secret-value")
+
+	r := NewResolver()
+	value, err := r.Resolve("DB/PASSWORD")
+	assert.NoError(t, err)
+	assert.Equal(t, "env-secret-value", value)
+	assert.True(t, values.IsSensitive("env-secret-value"))
+
+	t.Setenv("PIN", "4711")
+	_, err = r.Resolve("PIN")
+	assert.NoError(t, err)
+	assert.Equal(t, "pin [REDACTED]", values.RedactString("pin 4711"), "short secrets are redacted too")
+
+	_, err = r.Resolve("MISSING_SECRET")
+	assert.Error(t, err)
+}
+
+func TestResolverDispatchAndCache(t *testing.T) {
+	calls := 0
+	r := NewResolver()
+	r.Register("custom", ProviderFunc(func(ref string) (string, error) {
+		calls++
+		return "custom-" + ref, nil
+	}))
+
+	for i := 0; i < 3; i++ {
+		value, err := r.Resolve("custom:db/password")
+		assert.NoError(t, err)
+		assert.Equal(t, "custom-db/password", value)
+	}
+	assert.Equal(t, 1, calls, "resolved secrets must be cached")
+
+	assert.NoError(t, r.SetDefault("custom"))
+	value, err := r.Resolve("unknown:ref")
+	assert.NoError(t, err)
+	assert.Equal(t, "custom-unknown:ref", value, "unknown prefixes go to the default provider")
+
+	assert.Error(t, r.SetDefault("missing"))
+}
+
+func TestResolverWithConfig(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "secrets.yaml"), []byte("db:\n  password: file-secret-value\n  port: 5432\n"), 0600)
+	if err != nil {
+		t.Fatalf("failed to write secrets file: %v", err)
+	}
+	t.Setenv("APP_TOKEN", "prefixed-env-value")
+
+	parent := NewResolver()
+	r, err := parent.With(Config{
+		Default: "local",
+		Providers: map[string]ProviderConfig{
+			"local": {Type: "file", Path: "secrets.yaml"},
+			"app":   {Type: "env", Prefix: "APP_"},
+			"cmd":   {Type: "exec", Command: []string{"sh", "-c", `echo "exec-$0"`}},
+		},
+	}, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	value, err := r.Resolve("db/password")
+	assert.NoError(t, err)
+	assert.Equal(t, "file-secret-value", value)
+
+	value, err = r.Resolve("local:db/port")
+	assert.NoError(t, err)
+	assert.Equal(t, "5432", value)
+
+	_, err = r.Resolve("db")
+	assert.Error(t, err, "maps are not secrets")
+	_, err = r.Resolve("db/missing")
+	assert.Error(t, err)
+
+	value, err = r.Resolve("app:TOKEN")
+	assert.NoError(t, err)
+	assert.Equal(t, "prefixed-env-value", value)
+
+	value, err = r.Resolve("cmd:vault/db")
+	assert.NoError(t, err)
+	assert.Equal(t, "exec-vault/db", value)
+
+	// The parent is not affected by the child's configuration
+	_, err = parent.Resolve("local:db/password")
+	assert.Error(t, err)
+}
+
+func TestResolverLoadOptions(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "secrets.yaml"), []byte("token: ${TOKEN}-literal\n"), 0600); err != nil {
+		t.Fatalf("failed to write secrets file: %v", err)
+	}
+	t.Setenv("TOKEN", "from-env")
+
+	parent := NewResolver()
+	parent.SetLoadOptions(values.LoadOptions{NoEnvSubst: true})
+	r, err := parent.With(Config{Providers: map[string]ProviderConfig{"local": {Type: "file", Path: "secrets.yaml"}}}, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	value, err := r.Resolve("local:token")
+	assert.NoError(t, err)
+	assert.Equal(t, "${TOKEN}-literal", value, "file providers inherit the load options")
+}
+
+func TestResolverWithInvalidConfig(t *testing.T) {
+	r := NewResolver()
+	_, err := r.With(Config{Providers: map[string]ProviderConfig{"x": {Type: "unknown"}}}, ".")
+	assert.Error(t, err)
+	_, err = r.With(Config{Providers: map[string]ProviderConfig{"x": {Type: "file"}}}, ".")
+	assert.Error(t, err)
+	_, err = r.With(Config{Providers: map[string]ProviderConfig{"x": {Type: "exec"}}}, ".")
+	assert.Error(t, err)
+	_, err = r.With(Config{Default: "missing"}, ".")
+	assert.Error(t, err)
+}
+
+func TestExecProviderFailureIsRedacted(t *testing.T) {
+	p, err := newExecProvider(ProviderConfig{Command: []string{"sh", "-c", `echo "leaked-exec-secret"; echo "bad leaked-exec-secret" >&2; exit 3`}}, ".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = p.Resolve("ref")
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "leaked-exec-secret")
+	}
+}
+
+func TestRegisterType(t *testing.T) {
+	RegisterType("static", func(config ProviderConfig, dir string) (Provider, error) {
+		return ProviderFunc(func(ref string) (string, error) { return config.Prefix + ref, nil }), nil
+	})
+	r, err := NewResolver().With(Config{Providers: map[string]ProviderConfig{"s": {Type: "static", Prefix: "static-"}}}, ".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	value, err := r.Resolve("s:value")
+	assert.NoError(t, err)
+	assert.Equal(t, "static-value", value)
+}
@@ -0,0 +1,89 @@
+package tome
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// fileDelimsPattern matches the magic comment on the first line of a file
+// that sets the delimiters for that file, e.g. "# templar: delims [[ ]]".
+var fileDelimsPattern = regexp.MustCompile(`templar:\s*delims\s*=?\s*(\S+)\s+(\S+)`)
+
+// ValidateDelims checks that delims holds a non-empty left and right delimiter.
+func ValidateDelims(delims []string) error {
+	if len(delims) == 0 {
+		return nil
+	}
+	if len(delims) != 2 || delims[0] == "" || delims[1] == "" {
+		return fmt.Errorf("invalid delimiters %q, expected a left and a right delimiter", delims)
+	}
+	return nil
+}
+
+// delims returns the tome's template delimiters, defaulting to "{{" and "}}".
+func (t *Tome) delims() (string, string) {
+	if len(t.Delims) == 2 {
+		return t.Delims[0], t.Delims[1]
+	}
+	return "{{", "}}"
+}
+
+// fileDelims returns the delimiters text is parsed with: the tome's, or the
+// ones set by a magic comment on the first line of text. The magic comment is
+// replaced by a template comment of the same length, so positions in error
+// messages and warnings still match the original text. newline is the line
+// ending after the magic comment, or empty if there is none.
+func (t *Tome) fileDelims(text string) (left, right, parsed, newline string) {
+	left, right = t.delims()
+	line, end := text, ""
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		line, end = text[:i], "\n"
+		if strings.HasSuffix(line, "\r") {
+			line, end = line[:len(line)-1], "\r\n"
+		}
+	}
+	match := fileDelimsPattern.FindStringSubmatch(line)
+	if match == nil {
+		return left, right, text, ""
+	}
+	left, right = match[1], match[2]
+	return left, right, left + "/*" + strings.Repeat(" ", len(line)-len(left)-len(right)-4) + "*/" + right + text[len(line):], end
+}
+
+// parse parses text into tmpl with the delimiters returned by fileDelims.
+// The line ending of a magic comment is dropped from the output.
+func (t *Tome) parse(tmpl *template.Template, text string) (*template.Template, error) {
+	left, right, text, newline := t.fileDelims(text)
+	tmpl, err := tmpl.Delims(left, right).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if t.TrimBlocks {
+		trimBlocks(tmpl, text, left, right)
+	}
+	if root := tmpl.Tree.Root; newline != "" && len(root.Nodes) > 0 {
+		if n, ok := root.Nodes[0].(*parse.TextNode); ok {
+			n.Text = bytes.TrimPrefix(n.Text, []byte(newline))
+		}
+	}
+	return tmpl, nil
+}
+
+// parseTrees parses text with the delimiters returned by fileDelims into its
+// syntax trees, by template name, without checking that the functions it
+// calls are defined. It is used to find the values a template references,
+// which does not depend on plugin or script functions being loaded.
+func (t *Tome) parseTrees(name, text string) (map[string]*parse.Tree, error) {
+	left, right, text, _ := t.fileDelims(text)
+	trees := map[string]*parse.Tree{}
+	tree := parse.New(name)
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(text, left, right, trees); err != nil {
+		return nil, err
+	}
+	return trees, nil
+}
@@ -0,0 +1,127 @@
+package tome
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateDelims(t *testing.T) {
+	tests := []struct {
+		name     string
+		delims   []string
+		text     string
+		expected string
+		err      string
+	}{
+		{
+			name:     "default delimiters",
+			text:     "name: {{ .name }}",
+			expected: "name: web",
+		},
+		{
+			name:     "tome delimiters",
+			delims:   []string{"[[", "]]"},
+			text:     "name: [[ .name ]] ${{ github.ref }}",
+			expected: "name: web ${{ github.ref }}",
+		},
+		{
+			name:     "magic comment",
+			text:     "# templar: delims [[ ]]\nname: [[ .name ]]\nref: {{ github.ref }}\n",
+			expected: "name: web\nref: {{ github.ref }}\n",
+		},
+		{
+			name:     "magic comment overrides tome delimiters",
+			delims:   []string{"[[", "]]"},
+			text:     "<!-- templar: delims=<% %> -->\r\n<p><% .name %> [[ x ]]</p>",
+			expected: "<p>web [[ x ]]</p>",
+		},
+		{
+			name:     "magic comment only",
+			text:     "# templar: delims [[ ]]",
+			expected: "",
+		},
+		{
+			name:     "magic comment followed by trimming action",
+			text:     "# templar: delims [[ ]]\n[[- .name ]]",
+			expected: "web",
+		},
+		{
+			name:     "magic comment on second line is ignored",
+			text:     "name: {{ .name }}\n# templar: delims [[ ]]",
+			expected: "name: web\n# templar: delims [[ ]]",
+		},
+		{
+			name: "error positions match the original text",
+			text: "# templar: delims [[ ]]\nname: [[ .name ]\n",
+			err:  "test:2:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tome := &Tome{Delims: tt.delims, Values: map[string]any{"name": "web"}}
+			var b bytes.Buffer
+			err := tome.Template(&b, tt.text, "test")
+			if tt.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.err)
+				}
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.expected, b.String())
+			}
+		})
+	}
+}
+
+func TestValidateDelims(t *testing.T) {
+	assert.NoError(t, ValidateDelims(nil))
+	assert.NoError(t, ValidateDelims([]string{"[[", "]]"}))
+	assert.Error(t, ValidateDelims([]string{"[["}))
+	assert.Error(t, ValidateDelims([]string{"[[", ""}))
+}
+
+func TestRenderWithTomeDelims(t *testing.T) {
+	in := t.TempDir()
+	out := t.TempDir()
+	files := map[string]string{
+		".tome.yaml":               "delims: ['[[', ']]']\nvalues:\n  env: {{ .env | upper }}\n",
+		"[[ .name ]].yaml":         "name: [[ .name ]]\nimage: ${{ env.IMAGE }}\n",
+		"_helpers.tpl":             `[[ define "env" ]]env=[[ .env ]][[ end ]]`,
+		"env.txt":                  `[[ template "env" . ]]`,
+		"curly/.tome.yaml":         "# templar: delims (( ))\ndelims: ['<%', '%>']\nvalues:\n  greeting: hi (( .name ))\n",
+		"curly/<% .name %>.txt":    "<% .greeting %>",
+		"curly/override.txt":       "# templar: delims {{ }}\n{{ .name }} <% .name %>",
+		"curly/inherits/file.conf": "<% .env %>",
+	}
+	writeTree(t, in, files)
+
+	base, err := New(in, out, "", nil, nil, nil, nil, nil, map[string]any{"name": "web", "env": "prod"})
+	if err != nil {
+		t.Fatalf("failed to create tome: %v", err)
+	}
+	if err := base.LoadPartials(nil); err != nil {
+		t.Fatalf("failed to load partials: %v", err)
+	}
+	if err := base.Render(in); err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+
+	expected := map[string]string{
+		"web.yaml":                 "name: web\nimage: ${{ env.IMAGE }}\n",
+		"env.txt":                  "env=PROD",
+		"curly/web.txt":            "hi web",
+		"curly/override.txt":       "web <% .name %>",
+		"curly/inherits/file.conf": "PROD",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(out, name))
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, content, string(data), name)
+		}
+	}
+}
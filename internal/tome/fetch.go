@@ -0,0 +1,168 @@
+package tome
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"templar/internal/options"
+	"time"
+)
+
+const (
+	defaultHTTPTimeout = 30 * time.Second
+	defaultHTTPMaxSize = 10 << 20 // 10 MiB
+)
+
+// fetchURL downloads rawURL for include, honouring --no-network, the host
+// allow-list, the timeout and size limits and the local HTTP cache. If
+// checksum ("sha256:<hex>" or "sha512:<hex>") is given, the content must match it.
+func fetchURL(rawURL string, checksum string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %w", rawURL, err)
+	}
+
+	var expected []byte
+	var newHash func() hash.Hash
+	if checksum != "" {
+		newHash, expected, err = parseChecksum(checksum)
+		if err != nil {
+			return nil, err
+		}
+	}
+	verify := func(content []byte) error {
+		if newHash == nil {
+			return nil
+		}
+		h := newHash()
+		h.Write(content)
+		if actual := h.Sum(nil); hex.EncodeToString(actual) != hex.EncodeToString(expected) {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %x", rawURL, checksum, actual)
+		}
+		return nil
+	}
+
+	// Pinned content and offline builds are served from the cache
+	cacheFile := httpCacheFile(rawURL)
+	if cacheFile != "" && (checksum != "" || options.NoNetwork) {
+		if content, err := os.ReadFile(cacheFile); err == nil && verify(content) == nil {
+			return content, nil
+		}
+	}
+
+	if options.NoNetwork {
+		return nil, fmt.Errorf("cannot fetch %s: network access is disabled", rawURL)
+	}
+	if !hostAllowed(u.Hostname()) {
+		return nil, fmt.Errorf("cannot fetch %s: host %s is not in the allowed hosts", rawURL, u.Hostname())
+	}
+
+	timeout := options.HTTPTimeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	maxSize := options.HTTPMaxSize
+	if maxSize <= 0 {
+		maxSize = defaultHTTPMaxSize
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !hostAllowed(req.URL.Hostname()) {
+				return fmt.Errorf("redirect to host %s is not allowed", req.URL.Hostname())
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching URL %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching URL %s: status %s", rawURL, resp.Status)
+	}
+	if resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("error fetching URL %s: response of %d bytes exceeds limit of %d bytes", rawURL, resp.ContentLength, maxSize)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body from %s: %w", rawURL, err)
+	}
+	if int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("error fetching URL %s: response exceeds limit of %d bytes", rawURL, maxSize)
+	}
+	if err := verify(content); err != nil {
+		return nil, err
+	}
+
+	if cacheFile != "" {
+		if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+			return nil, fmt.Errorf("error creating HTTP cache directory: %w", err)
+		}
+		if err := os.WriteFile(cacheFile, content, 0644); err != nil {
+			return nil, fmt.Errorf("error writing HTTP cache: %w", err)
+		}
+	}
+	return content, nil
+}
+
+// parseChecksum parses "sha256:<hex>" or "sha512:<hex>".
+func parseChecksum(checksum string) (func() hash.Hash, []byte, error) {
+	algorithm, digest, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid checksum %q, expected <algorithm>:<hex digest>", checksum)
+	}
+	var newHash func() hash.Hash
+	switch strings.ToLower(algorithm) {
+	case "sha256":
+		newHash = sha256.New
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return nil, nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+	expected, err := hex.DecodeString(digest)
+	if err != nil || len(expected) != newHash().Size() {
+		return nil, nil, fmt.Errorf("invalid %s digest %q", algorithm, digest)
+	}
+	return newHash, expected, nil
+}
+
+// hostAllowed reports whether host matches the --allow-host list. An empty
+// list allows every host. Patterns may use wildcards, e.g. "*.example.com".
+func hostAllowed(host string) bool {
+	if len(options.AllowHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, pattern := range options.AllowHosts {
+		if matched, _ := path.Match(strings.ToLower(pattern), host); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// httpCacheFile returns the cache location for rawURL, or "" if no cache is configured.
+func httpCacheFile(rawURL string) string {
+	if options.HTTPCacheDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(options.HTTPCacheDir, hex.EncodeToString(sum[:]))
+}
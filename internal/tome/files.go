@@ -0,0 +1,164 @@
+package tome
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// glob returns the files matching pattern, relative to the current template
+// unless the pattern is absolute. Files excluded by the tome are skipped.
+func (rd *RenderDir) glob(pattern string) ([]string, error) {
+	absolute := filepath.IsAbs(pattern)
+	base, rest := doublestar.SplitPattern(filepath.ToSlash(pattern))
+	root, err := rd.resolvePath(filepath.FromSlash(base))
+	if err != nil {
+		return nil, err
+	}
+	matches, err := doublestar.Glob(os.DirFS(root), rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %s: %w", pattern, err)
+	}
+
+	result := make([]string, 0, len(matches))
+	for _, match := range matches {
+		path := filepath.Join(root, filepath.FromSlash(match))
+		if !rd.Tome.ShouldInclude(path) {
+			continue
+		}
+		// Symlinks may point outside of the sandbox
+		if _, err := rd.resolvePath(path); err != nil {
+			continue
+		}
+		if !absolute {
+			if path, err = filepath.Rel(rd.Dir, path); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, path)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// fileExists reports whether a file or directory exists and is included by the tome.
+func (rd *RenderDir) fileExists(path string) (bool, error) {
+	path, err := rd.resolvePath(path)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return rd.Tome.ShouldInclude(path), nil
+}
+
+// readDir returns the sorted names of the entries of a directory included by the tome.
+func (rd *RenderDir) readDir(path string) ([]string, error) {
+	path, err := rd.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %s: %w", path, err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if rd.Tome.ShouldInclude(filepath.Join(path, entry.Name())) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// fileHash returns the hex encoded hash of a file, sha256 unless another
+// algorithm (sha1, sha512 or md5) is given.
+func (rd *RenderDir) fileHash(path string, algorithm ...string) (string, error) {
+	var h hash.Hash
+	name := "sha256"
+	if len(algorithm) > 0 {
+		name = algorithm[0]
+	}
+	switch name {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	case "sha1":
+		h = sha1.New()
+	case "md5":
+		h = md5.New()
+	default:
+		return "", fmt.Errorf("unsupported hash algorithm %q", name)
+	}
+
+	path, err := rd.includedFile(path)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening file %s: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("error reading file %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fileSize returns the size of a file in bytes.
+func (rd *RenderDir) fileSize(path string) (int64, error) {
+	path, err := rd.includedFile(path)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+	return info.Size(), nil
+}
+
+// relPath returns path relative to the directory of the current template.
+func (rd *RenderDir) relPath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rd.Dir, path)
+	}
+	dir, err := filepath.Abs(rd.Dir)
+	if err != nil {
+		return "", err
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return "", err
+	}
+	return filepath.Rel(dir, path)
+}
+
+// includedFile resolves path like resolvePath and rejects files excluded by the tome.
+func (rd *RenderDir) includedFile(path string) (string, error) {
+	path, err := rd.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	if !rd.Tome.ShouldInclude(path) {
+		return "", fmt.Errorf("%s is excluded by the tome", path)
+	}
+	return path, nil
+}
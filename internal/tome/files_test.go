@@ -0,0 +1,110 @@
+package tome
+
+import (
+	"os"
+	"path/filepath"
+	"templar/internal/options"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupFilesTree(t *testing.T) string {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.txt":          "hello",
+		"b.txt":          "world!",
+		"skip.bak":       "backup",
+		"conf/app.yaml":  "app: true",
+		"conf/db.yaml":   "db: true",
+		"conf/notes.bak": "notes",
+	} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestFileFunctions(t *testing.T) {
+	dir := setupFilesTree(t)
+	rd := RenderDir{Dir: dir, Tome: &Tome{Source: dir, Exclude: []string{"**/*.bak"}}}
+
+	matches, err := rd.glob("**/*.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"conf/app.yaml", "conf/db.yaml"}, matches)
+
+	matches, err = rd.glob("*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "b.txt", "conf"}, matches)
+
+	matches, err = rd.glob(filepath.Join(dir, "conf", "*.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "conf/app.yaml"), filepath.Join(dir, "conf/db.yaml")}, matches)
+
+	exists, err := rd.fileExists("a.txt")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = rd.fileExists("missing.txt")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = rd.fileExists("skip.bak")
+	assert.NoError(t, err)
+	assert.False(t, exists, "excluded files do not exist for templates")
+
+	names, err := rd.readDir("conf")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app.yaml", "db.yaml"}, names)
+
+	hash, err := rd.fileHash("a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", hash)
+	hash, err = rd.fileHash("a.txt", "md5")
+	assert.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", hash)
+	_, err = rd.fileHash("a.txt", "crc32")
+	assert.Error(t, err)
+	_, err = rd.fileHash("skip.bak")
+	assert.Error(t, err)
+
+	size, err := rd.fileSize("b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), size)
+
+	rel, err := rd.relPath(filepath.Join(dir, "conf", "app.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "conf/app.yaml", rel)
+	rd.Dir = filepath.Join(dir, "conf")
+	rel, err = rd.relPath(filepath.Join(dir, "a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "../a.txt", rel)
+}
+
+func TestFileFunctionsSandbox(t *testing.T) {
+	defer func(sandbox bool) { options.Sandbox = sandbox }(options.Sandbox)
+	options.Sandbox = true
+
+	dir := setupFilesTree(t)
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "conf", "link.yaml"))
+
+	rd := RenderDir{Dir: dir, Tome: &Tome{Source: dir}}
+
+	matches, err := rd.glob("conf/*.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"conf/app.yaml", "conf/db.yaml"}, matches, "symlinks escaping the sandbox are skipped")
+
+	_, err = rd.glob(filepath.Join(outside, "*"))
+	assert.Error(t, err)
+	_, err = rd.fileExists(filepath.Join(outside, "secret.txt"))
+	assert.Error(t, err)
+	_, err = rd.readDir(outside)
+	assert.Error(t, err)
+	_, err = rd.fileHash("conf/link.yaml")
+	assert.Error(t, err)
+	_, err = rd.fileSize("../" + filepath.Base(outside) + "/secret.txt")
+	assert.Error(t, err)
+}
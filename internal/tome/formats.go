@@ -0,0 +1,364 @@
+package tome
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// toIni converts a map to INI. Scalar top-level keys come first, nested maps
+// become sections, named with dots when nested deeper.
+func toIni(v any) (string, error) {
+	m, ok := generic(v).(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("error converting to INI: expected a map, got %T", v)
+	}
+	var b strings.Builder
+	if err := writeIniSection(&b, "", m); err != nil {
+		return "", fmt.Errorf("error converting to INI: %w", err)
+	}
+	return b.String(), nil
+}
+
+func writeIniSection(b *strings.Builder, name string, m map[string]any) error {
+	keys := sortedKeys(m)
+	var sections []string
+	wroteHeader := false
+	for _, key := range keys {
+		switch value := m[key].(type) {
+		case map[string]any:
+			sections = append(sections, key)
+		case []any:
+			return fmt.Errorf("unsupported list value for key %s", joinKey(name, key))
+		default:
+			if name != "" && !wroteHeader {
+				if b.Len() > 0 {
+					b.WriteString("\n")
+				}
+				fmt.Fprintf(b, "[%s]\n", name)
+				wroteHeader = true
+			}
+			fmt.Fprintf(b, "%s = %s\n", key, scalarString(value))
+		}
+	}
+	for _, key := range sections {
+		if err := writeIniSection(b, joinKey(name, key), m[key].(map[string]any)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toProperties converts a map to Java properties. Nested keys are joined with
+// dots and list elements are indexed, e.g. "servers.0.name".
+func toProperties(v any) (string, error) {
+	m, ok := generic(v).(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("error converting to properties: expected a map, got %T", v)
+	}
+	flat := map[string]string{}
+	flatten("", m, flat)
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", escapeProperty(key, true), escapeProperty(flat[key], false))
+	}
+	return b.String(), nil
+}
+
+func flatten(prefix string, v any, flat map[string]string) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			flatten(joinKey(prefix, key), value, flat)
+		}
+	case []any:
+		for i, value := range v {
+			flatten(joinKey(prefix, strconv.Itoa(i)), value, flat)
+		}
+	default:
+		flat[prefix] = scalarString(v)
+	}
+}
+
+func escapeProperty(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '=', ':', '#', '!':
+			if key {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		case ' ':
+			// Spaces separate keys from values and leading spaces are trimmed
+			if key || i == 0 {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		default:
+			if r > 0x7e || r < 0x20 {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+var hclIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// toHcl converts a map to HCL attributes, as used in .tfvars files.
+func toHcl(v any) (string, error) {
+	m, ok := generic(v).(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("error converting to HCL: expected a map, got %T", v)
+	}
+	var b strings.Builder
+	for _, key := range sortedKeys(m) {
+		if !hclIdentifier.MatchString(key) {
+			return "", fmt.Errorf("error converting to HCL: %q is not a valid attribute name", key)
+		}
+		b.WriteString(key)
+		b.WriteString(" = ")
+		writeHclValue(&b, m[key], "")
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+func writeHclValue(b *strings.Builder, v any, indent string) {
+	switch v := v.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		b.WriteString("{\n")
+		for _, key := range sortedKeys(v) {
+			b.WriteString(indent + "  ")
+			if hclIdentifier.MatchString(key) {
+				b.WriteString(key)
+			} else {
+				b.WriteString(hclString(key))
+			}
+			b.WriteString(" = ")
+			writeHclValue(b, v[key], indent+"  ")
+			b.WriteString("\n")
+		}
+		b.WriteString(indent + "}")
+	case []any:
+		if len(v) == 0 {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteString("[\n")
+		for _, value := range v {
+			b.WriteString(indent + "  ")
+			writeHclValue(b, value, indent+"  ")
+			b.WriteString(",\n")
+		}
+		b.WriteString(indent + "]")
+	case nil:
+		b.WriteString("null")
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, json.Number:
+		b.WriteString(fmt.Sprint(v))
+	default:
+		b.WriteString(hclString(fmt.Sprint(v)))
+	}
+}
+
+// hclString quotes s, escaping template sequences so they are taken literally.
+func hclString(s string) string {
+	s = strconv.Quote(s)
+	s = strings.ReplaceAll(s, "${", "$${")
+	return strings.ReplaceAll(s, "%{", "%%{")
+}
+
+// toXml converts a value to an XML document. An optional root element name
+// may precede the value (default "root"). Map keys starting with "@" become
+// attributes and "#text" the element's text, lists repeat their element.
+func toXml(args ...any) (string, error) {
+	root := "root"
+	switch len(args) {
+	case 1:
+	case 2:
+		name, ok := args[0].(string)
+		if !ok {
+			return "", fmt.Errorf("error converting to XML: root element name must be a string, got %T", args[0])
+		}
+		root = name
+	default:
+		return "", fmt.Errorf("error converting to XML: expected an optional root element name and a value, got %d arguments", len(args))
+	}
+
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	if err := writeXmlElement(&b, root, generic(args[len(args)-1]), ""); err != nil {
+		return "", fmt.Errorf("error converting to XML: %w", err)
+	}
+	return b.String(), nil
+}
+
+var xmlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9._-]*$`)
+
+func writeXmlElement(b *bytes.Buffer, name string, v any, indent string) error {
+	if !xmlName.MatchString(name) {
+		return fmt.Errorf("%q is not a valid element name", name)
+	}
+	if list, ok := v.([]any); ok {
+		for _, value := range list {
+			if err := writeXmlElement(b, name, value, indent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	b.WriteString(indent + "<" + name)
+	m, isMap := v.(map[string]any)
+	if !isMap {
+		if v == nil {
+			b.WriteString("/>\n")
+			return nil
+		}
+		b.WriteString(">")
+		xml.EscapeText(b, []byte(scalarString(v)))
+		b.WriteString("</" + name + ">\n")
+		return nil
+	}
+
+	var children []string
+	for _, key := range sortedKeys(m) {
+		if attr, ok := strings.CutPrefix(key, "@"); ok {
+			if !xmlName.MatchString(attr) {
+				return fmt.Errorf("%q is not a valid attribute name", attr)
+			}
+			b.WriteString(" " + attr + `="`)
+			xml.EscapeText(b, []byte(scalarString(m[key])))
+			b.WriteString(`"`)
+		} else if key != "#text" {
+			children = append(children, key)
+		}
+	}
+	text, hasText := m["#text"]
+	if len(children) == 0 && !hasText {
+		b.WriteString("/>\n")
+		return nil
+	}
+	b.WriteString(">")
+	if hasText {
+		xml.EscapeText(b, []byte(scalarString(text)))
+	}
+	if len(children) > 0 {
+		b.WriteString("\n")
+		for _, key := range children {
+			if err := writeXmlElement(b, key, m[key], indent+"  "); err != nil {
+				return err
+			}
+		}
+		b.WriteString(indent)
+	}
+	b.WriteString("</" + name + ">\n")
+	return nil
+}
+
+// generic converts maps, slices and structs to map[string]any and []any, so
+// the serializers only have to handle those.
+func generic(v any) any {
+	switch v := v.(type) {
+	case nil, string, bool, json.Number:
+		return v
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[key] = generic(value)
+		}
+		return m
+	case []any:
+		a := make([]any, len(v))
+		for i, value := range v {
+			a[i] = generic(value)
+		}
+		return a
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		m := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = generic(iter.Value().Interface())
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return v
+		}
+		a := make([]any, rv.Len())
+		for i := range a {
+			a[i] = generic(rv.Index(i).Interface())
+		}
+		return a
+	case reflect.Struct, reflect.Pointer:
+		// Structs are converted through their JSON representation
+		data, err := json.Marshal(v)
+		if err != nil {
+			return v
+		}
+		var out any
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&out); err != nil {
+			return v
+		}
+		return generic(out)
+	default:
+		return v
+	}
+}
+
+func scalarString(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,121 @@
+package tome
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToIni(t *testing.T) {
+	input := map[string]any{
+		"name": "app",
+		"database": map[string]any{
+			"host": "localhost",
+			"port": 5432,
+			"pool": map[string]any{"size": 10},
+		},
+		"cache": map[string]string{"ttl": "5m"},
+	}
+	expected := `name = app
+
+[cache]
+ttl = 5m
+
+[database]
+host = localhost
+port = 5432
+
+[database.pool]
+size = 10
+`
+	result, err := toIni(input)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	_, err = toIni(map[string]any{"hosts": []any{"a", "b"}})
+	assert.Error(t, err)
+	_, err = toIni("scalar")
+	assert.Error(t, err)
+}
+
+func TestToProperties(t *testing.T) {
+	input := map[string]any{
+		"app": map[string]any{
+			"name":    "my app",
+			"servers": []any{"a", "b"},
+		},
+		"key with=sep": "line1\nline2",
+		"empty":        nil,
+	}
+	expected := `app.name=my app
+app.servers.0=a
+app.servers.1=b
+empty=
+key\ with\=sep=line1\nline2
+`
+	result, err := toProperties(input)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+}
+
+func TestToHcl(t *testing.T) {
+	input := map[string]any{
+		"region":   "eu-west-1",
+		"replicas": 3,
+		"enabled":  true,
+		"tags":     map[string]any{"team": "core", "cost-center": "42", "a b": "${x}"},
+		"zones":    []any{"a", "b"},
+		"empty":    []any{},
+	}
+	expected := `empty = []
+enabled = true
+region = "eu-west-1"
+replicas = 3
+tags = {
+  "a b" = "$${x}"
+  cost-center = "42"
+  team = "core"
+}
+zones = [
+  "a",
+  "b",
+]
+`
+	result, err := toHcl(input)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	_, err = toHcl(map[string]any{"not valid": 1})
+	assert.Error(t, err)
+}
+
+func TestToXml(t *testing.T) {
+	input := map[string]any{
+		"server": []any{
+			map[string]any{"@name": "web", "port": 80},
+			map[string]any{"@name": "db", "#text": "primary & only"},
+		},
+		"empty": nil,
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<config>
+  <empty/>
+  <server name="web">
+    <port>80</port>
+  </server>
+  <server name="db">primary &amp; only</server>
+</config>
+`
+	result, err := toXml("config", input)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	result, err = toXml("value")
+	assert.NoError(t, err)
+	assert.Equal(t, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<root>value</root>\n", result)
+
+	_, err = toXml(map[string]any{"bad name": 1})
+	assert.Error(t, err)
+	_, err = toXml(1, "value")
+	assert.Error(t, err)
+}
@@ -2,14 +2,17 @@ package tome
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/template"
+	"unicode"
 
 	"github.com/BurntSushi/toml"
 	"github.com/Masterminds/sprig/v3"
@@ -58,76 +61,207 @@ type RenderDir struct {
 	Tome *Tome
 }
 
-func (rd *RenderDir) importContent(path string) (string, error) {
-	var content []byte
-	var err error
-
-	if u, parseErr := url.Parse(path); parseErr == nil && (u.Scheme == "http" || u.Scheme == "https") {
-		// URL path
-		resp, httpErr := http.Get(path)
-		if httpErr != nil {
-			return "", fmt.Errorf("error fetching URL %s: %w", path, httpErr)
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != 200 {
-			return "", fmt.Errorf("error fetching URL %s: status %s", path, resp.Status)
-		}
-		content, err = io.ReadAll(resp.Body)
-		if err != nil {
-			return "", fmt.Errorf("error reading response body from %s: %w", path, err)
-		}
-	} else {
-		// Local file path
-		if path[0] != '/' {
-			path = filepath.Join(rd.Dir, path)
-		}
-		content, err = os.ReadFile(path)
-		if err != nil {
-			return "", fmt.Errorf("error reading file %s: %w", path, err)
+// importContent reads a local file or URL and templates it with the tome's
+// values. URLs may be pinned with a checksum, e.g. include "https://..." "sha256:...",
+// and a final argument renders the content with that data instead, e.g. include "file" .sub.
+func (rd *RenderDir) importContent(path string, args ...any) (string, error) {
+	checksum := ""
+	if len(args) > 0 && isURL(path) {
+		if s, ok := args[0].(string); ok && isChecksum(s) {
+			checksum, args = s, args[1:]
 		}
 	}
+	if len(args) > 1 {
+		return "", fmt.Errorf("include accepts a checksum and one data argument, got %d extra arguments", len(args))
+	}
+
+	content, path, err := rd.readContent(path, checksum)
+	if err != nil {
+		return "", err
+	}
 
 	var templatedContent bytes.Buffer
-	err = rd.Tome.Template(&templatedContent, string(content), path)
+	if len(args) == 1 {
+		err = rd.Tome.templateData(&templatedContent, string(content), path, filepath.Dir(path), args[0])
+	} else {
+		err = rd.Tome.Template(&templatedContent, string(content), path)
+	}
 	if err != nil {
 		return "", fmt.Errorf("error templating import: %w", err)
 	}
 	return templatedContent.String(), nil
 }
 
-func toYaml(v any) (string, error) {
-	// Marshal the value to YAML
-	data, err := yaml.Marshal(v)
+// includeRaw returns the content of a local file or URL without templating it.
+func (rd *RenderDir) includeRaw(path string, checksum ...string) (string, error) {
+	content, err := rd.readRaw(path, checksum)
+	return string(content), err
+}
+
+// includeBase64 returns the base64 encoded content of a local file or URL.
+func (rd *RenderDir) includeBase64(path string, checksum ...string) (string, error) {
+	content, err := rd.readRaw(path, checksum)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(content), nil
+}
+
+// readFile returns the content of a local file without templating it.
+func (rd *RenderDir) readFile(path string) (string, error) {
+	if isURL(path) {
+		return "", fmt.Errorf("readFile only reads local files, use includeRaw for %s", path)
+	}
+	content, _, err := rd.readContent(path, "")
+	return string(content), err
+}
+
+func (rd *RenderDir) readRaw(path string, checksum []string) ([]byte, error) {
+	if len(checksum) > 1 {
+		return nil, fmt.Errorf("at most one checksum is accepted, got %d", len(checksum))
+	}
+	pin := ""
+	if len(checksum) == 1 {
+		pin = checksum[0]
+	}
+	content, _, err := rd.readContent(path, pin)
+	return content, err
+}
+
+// readContent reads a URL or a local file relative to the template directory,
+// returning the content and the path it was read from.
+func (rd *RenderDir) readContent(path string, checksum string) ([]byte, string, error) {
+	if isURL(path) {
+		content, err := fetchURL(path, checksum)
+		return content, path, err
+	}
+
+	if checksum != "" {
+		return nil, path, fmt.Errorf("checksums are only supported for URLs")
+	}
+	path, err := rd.resolvePath(path)
+	if err != nil {
+		return nil, path, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, path, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+	return content, path, nil
+}
+
+func isURL(path string) bool {
+	u, err := url.Parse(path)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// isChecksum reports whether s has the shape of a checksum, "<algorithm>:<hex>",
+// whatever the algorithm, so unsupported algorithms fail instead of being
+// used as template data.
+func isChecksum(s string) bool {
+	algorithm, digest, ok := strings.Cut(s, ":")
+	if !ok || algorithm == "" || digest == "" {
+		return false
+	}
+	for _, c := range algorithm {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '-' {
+			return false
+		}
+	}
+	return strings.Trim(digest, "0123456789abcdefABCDEF") == ""
+}
+
+// toYaml converts a value to YAML. An optional indent may precede the value,
+// e.g. toYaml 2 .config or .config | toYaml 2.
+func toYaml(args ...any) (string, error) {
+	indent, v, err := indentArgs("YAML", 4, 2, 9, args)
 	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(indent)
+	if err := encoder.Encode(v); err != nil {
 		return "", fmt.Errorf("error converting to YAML: %w", err)
 	}
-	// Convert the byte slice to a string
-	return string(data), nil
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("error converting to YAML: %w", err)
+	}
+	return b.String(), nil
+}
+
+// indentArgs splits the arguments of a serializer into an optional leading
+// indent between min and max and the value to serialize.
+func indentArgs(format string, indent, min, max int, args []any) (int, any, error) {
+	switch len(args) {
+	case 1:
+		return indent, args[0], nil
+	case 2:
+		n, ok := args[0].(int)
+		if !ok || n < min || n > max {
+			return 0, nil, fmt.Errorf("error converting to %s: indent must be an integer from %d to %d, got %v", format, min, max, args[0])
+		}
+		return n, args[1], nil
+	default:
+		return 0, nil, fmt.Errorf("error converting to %s: expected an optional indent and a value, got %d arguments", format, len(args))
+	}
 }
 
-func fromYaml(str string) (map[any]any, error) {
-	ret := map[any]any{}
+// fromYaml parses a YAML document like mustFromYaml, but returns a map with
+// the parse error under "Error" instead of failing, like Helm does.
+func fromYaml(str string) any {
+	v, err := mustFromYaml(str)
+	if err != nil {
+		return map[string]any{"Error": err.Error()}
+	}
+	return v
+}
 
-	if err := yaml.Unmarshal([]byte(str), &ret); err != nil {
-		a := []any{}
-		if err := yaml.Unmarshal([]byte(str), &a); err != nil {
-			return nil, fmt.Errorf("error converting from YAML: %w", err)
+// mustFromYaml parses a YAML document into a map[string]any, or an []any if it is a sequence.
+func mustFromYaml(str string) (any, error) {
+	var v any
+	if err := yaml.Unmarshal([]byte(str), &v); err != nil {
+		return nil, fmt.Errorf("error converting from YAML: %w", err)
+	}
+	return collection(normalize(v), "YAML")
+}
+
+// fromYamlArray parses a YAML sequence into an []any.
+func fromYamlArray(str string) ([]any, error) {
+	v, err := mustFromYaml(str)
+	if err != nil {
+		return nil, err
+	}
+	return asArray(v, "YAML")
+}
+
+// fromYamlAll parses every document of a multi-document YAML stream. Empty
+// documents are skipped.
+func fromYamlAll(str string) ([]any, error) {
+	decoder := yaml.NewDecoder(strings.NewReader(str))
+	docs := []any{}
+	for {
+		var v any
+		err := decoder.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error converting from YAML document %d: %w", len(docs)+1, err)
 		}
-		for i, v := range a {
-			ret[i] = v
+		if v != nil {
+			docs = append(docs, normalize(v))
 		}
 	}
-	return ret, nil
 }
 
-func toToml(v any) string {
+func toToml(v any) (string, error) {
 	b := bytes.NewBuffer(nil)
 	e := toml.NewEncoder(b)
-	err := e.Encode(v)
-	if err != nil {
-		return err.Error()
+	if err := e.Encode(v); err != nil {
+		return "", fmt.Errorf("error converting to TOML: %w", err)
 	}
-	return b.String()
+	return b.String(), nil
 }
 
 func fromToml(str string) (map[string]any, error) {
@@ -135,33 +269,122 @@ func fromToml(str string) (map[string]any, error) {
 	if err := toml.Unmarshal([]byte(str), &ret); err != nil {
 		return nil, fmt.Errorf("error converting from TOML: %w", err)
 	}
-	return ret, nil
+	return normalize(ret).(map[string]any), nil
 }
 
+// toJson converts a value to compact JSON, with map keys sorted.
 func toJson(v any) (string, error) {
-	data, err := json.Marshal(v)
+	data, err := json.Marshal(generic(v))
 	if err != nil {
 		return "", fmt.Errorf("error converting to JSON: %w", err)
 	}
 	return string(data), nil
 }
 
-func fromJson(str string) (map[any]any, error) {
-	ret := map[any]any{}
-	m := map[string]any{}
-	if err := json.Unmarshal([]byte(str), &m); err != nil {
-		a := []any{}
-		if err := json.Unmarshal([]byte(str), &a); err != nil {
-			return nil, fmt.Errorf("error converting from JSON: %w", err)
+// toPrettyJson converts a value to indented JSON, with map keys sorted. An
+// optional indent may precede the value (default 2).
+func toPrettyJson(args ...any) (string, error) {
+	indent, v, err := indentArgs("JSON", 2, 1, 16, args)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(generic(v), "", strings.Repeat(" ", indent))
+	if err != nil {
+		return "", fmt.Errorf("error converting to JSON: %w", err)
+	}
+	return string(data), nil
+}
+
+// fromJson parses a JSON document like mustFromJson, but returns a map with
+// the parse error under "Error" instead of failing, like Helm does.
+func fromJson(str string) any {
+	v, err := mustFromJson(str)
+	if err != nil {
+		return map[string]any{"Error": err.Error()}
+	}
+	return v
+}
+
+// mustFromJson parses a JSON object into a map[string]any, or an []any if it is an array.
+func mustFromJson(str string) (any, error) {
+	var v any
+	if err := json.Unmarshal([]byte(str), &v); err != nil {
+		return nil, fmt.Errorf("error converting from JSON: %w", err)
+	}
+	return collection(v, "JSON")
+}
+
+// fromJsonArray parses a JSON array into an []any.
+func fromJsonArray(str string) ([]any, error) {
+	v, err := mustFromJson(str)
+	if err != nil {
+		return nil, err
+	}
+	return asArray(v, "JSON")
+}
+
+// collection checks that a decoded document is a map or a list. An empty
+// document decodes to an empty map.
+func collection(v any, format string) (any, error) {
+	switch v := v.(type) {
+	case map[string]any, []any:
+		return v, nil
+	case nil:
+		return map[string]any{}, nil
+	default:
+		return nil, fmt.Errorf("error converting from %s: expected a map or a list, got %T", format, v)
+	}
+}
+
+func asArray(v any, format string) ([]any, error) {
+	if m, ok := v.(map[string]any); ok && len(m) == 0 {
+		return []any{}, nil
+	}
+	a, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("error converting from %s: expected a list, got %T", format, v)
+	}
+	return a, nil
+}
+
+// normalize converts decoded maps and lists to map[string]any and []any, so
+// they work with toJson, range and the sprig dict functions. Non-string map
+// keys are formatted as strings.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = normalize(value)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = normalize(value)
 		}
-		for i, v := range a {
-			ret[i] = v
+		return m
+	case []any:
+		for i, value := range v {
+			v[i] = normalize(value)
 		}
+		return v
+	case []map[string]any:
+		a := make([]any, len(v))
+		for i, value := range v {
+			a[i] = normalize(value)
+		}
+		return a
+	default:
+		return v
 	}
-	for i, v := range m {
-		ret[i] = v
+}
+
+// secret resolves a secret reference through the tome's secret providers.
+func (t *Tome) secret(ref string) (string, error) {
+	if t.Secrets == nil {
+		t.Secrets = newSecretsResolver()
 	}
-	return ret, nil
+	return t.Secrets.Resolve(ref)
 }
 
 func required(v any) (any, error) {
@@ -178,15 +401,68 @@ func (t *Tome) funcMap(dir string) template.FuncMap {
 		Tome: t,
 	}
 	funcMap["include"] = rd.importContent
+	funcMap["includeRaw"] = rd.includeRaw
+	funcMap["includeBase64"] = rd.includeBase64
+	funcMap["readFile"] = rd.readFile
+	funcMap["glob"] = rd.glob
+	funcMap["fileExists"] = rd.fileExists
+	funcMap["readDir"] = rd.readDir
+	funcMap["fileHash"] = rd.fileHash
+	funcMap["fileSize"] = rd.fileSize
+	funcMap["relPath"] = rd.relPath
 
 	funcMap["seq"] = seq
 	funcMap["toToml"] = toToml
 	funcMap["fromToml"] = fromToml
 	funcMap["toYaml"] = toYaml
 	funcMap["fromYaml"] = fromYaml
+	funcMap["mustFromYaml"] = mustFromYaml
+	funcMap["fromYamlArray"] = fromYamlArray
+	funcMap["fromYamlAll"] = fromYamlAll
 	funcMap["toJson"] = toJson
+	funcMap["toPrettyJson"] = toPrettyJson
+	funcMap["toIni"] = toIni
+	funcMap["toProperties"] = toProperties
+	funcMap["toHcl"] = toHcl
+	funcMap["toXml"] = toXml
 	funcMap["fromJson"] = fromJson
+	funcMap["mustFromJson"] = mustFromJson
+	funcMap["fromJsonArray"] = fromJsonArray
 	funcMap["required"] = required
+	funcMap["tpl"] = rd.tpl
+	funcMap["get"] = t.get
+	funcMap["jsonpath"] = t.jsonpath
+	funcMap["jq"] = t.jq
+	funcMap["cidrHost"] = cidrHost
+	funcMap["cidrSubnet"] = cidrSubnet
+	funcMap["cidrSubnets"] = cidrSubnets
+	funcMap["cidrNetmask"] = cidrNetmask
+	funcMap["cidrContains"] = cidrContains
+	funcMap["parseIP"] = parseIP
+	funcMap["ipFamily"] = ipFamily
+	funcMap["isIPv4"] = isIPv4
+	funcMap["isIPv6"] = isIPv6
+	funcMap["portRange"] = portRange
+	funcMap["genPassword"] = t.genPassword
+	funcMap["genUUID"] = t.genUUID
+	funcMap["genKeyPair"] = t.genKeyPair
+	funcMap["genCert"] = t.genCert
+	funcMap["secret"] = t.secret
 
+	registered.Lock()
+	for name, fn := range registered.funcs {
+		funcMap[name] = fn
+	}
+	registered.Unlock()
+	for _, p := range t.Plugins {
+		for _, name := range p.Functions {
+			funcMap[name] = p.function(name)
+		}
+	}
+	for _, s := range t.Scripts {
+		for _, name := range s.Functions {
+			funcMap[name] = s.function(t, name)
+		}
+	}
 	return funcMap
 }
@@ -1,10 +1,16 @@
 package tome
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"templar/internal/options"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -95,17 +101,38 @@ func TestToYaml(t *testing.T) {
 	}
 }
 
+func TestToYamlIndent(t *testing.T) {
+	input := map[string]any{"a": map[string]any{"b": []any{"c"}}}
+
+	result, err := toYaml(input)
+	assert.NoError(t, err)
+	assert.Equal(t, "a:\n    b:\n        - c\n", result)
+
+	result, err = toYaml(2, input)
+	assert.NoError(t, err)
+	assert.Equal(t, "a:\n  b:\n    - c\n", result)
+
+	result, err = toYaml(9, map[string]any{"a": map[string]any{"b": 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, "a:\n         b: 1\n", result)
+
+	for _, indent := range []any{"2", 0, 1, 10, -2} {
+		_, err = toYaml(indent, input)
+		assert.Error(t, err, "indent %v", indent)
+	}
+}
+
 func TestFromYamlMap(t *testing.T) {
 	yamlStr := `
 key1: value1
 key2: value2
 `
-	expected := map[any]any{
+	expected := map[string]any{
 		"key1": "value1",
 		"key2": "value2",
 	}
 
-	result, err := fromYaml(yamlStr)
+	result, err := mustFromYaml(yamlStr)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -117,18 +144,134 @@ func TestFromYamlArray(t *testing.T) {
 - value1
 - value2
 `
-	expected := map[any]any{
-		0: "value1",
-		1: "value2",
-	}
+	expected := []any{"value1", "value2"}
 
-	result, err := fromYaml(yamlStr)
+	result, err := mustFromYaml(yamlStr)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
 	assert.Equal(t, expected, result)
 }
 
+func TestFromYamlNested(t *testing.T) {
+	yamlStr := `
+servers:
+  - name: web
+    ports: {80: http, 443: https}
+`
+	expected := map[string]any{
+		"servers": []any{
+			map[string]any{
+				"name":  "web",
+				"ports": map[string]any{"80": "http", "443": "https"},
+			},
+		},
+	}
+
+	result, err := mustFromYaml(yamlStr)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	// Maps with non-string keys in YAML must still convert to JSON
+	jsonStr, err := toJson(result)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"servers":[{"name":"web","ports":{"80":"http","443":"https"}}]}`, jsonStr)
+}
+
+func TestFromYamlArrayVariants(t *testing.T) {
+	result, err := fromYamlArray("- a\n- b\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"a", "b"}, result)
+
+	result, err = fromYamlArray("")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{}, result)
+
+	_, err = fromYamlArray("a: b")
+	assert.Error(t, err)
+
+	_, err = mustFromYaml("just a string")
+	assert.Error(t, err)
+
+	_, err = mustFromYaml("a: [b")
+	assert.Error(t, err)
+}
+
+func TestFromMalformedDocuments(t *testing.T) {
+	tome := &Tome{}
+	tests := []struct {
+		text string
+		want string
+		err  string
+	}{
+		{text: `{{ (fromYaml "a: [b").Error }}`, want: "error converting from YAML"},
+		{text: `{{ (fromJson "{").Error }}`, want: "error converting from JSON"},
+		{text: `{{ (fromYaml "a: b").a }}`, want: "b"},
+		{text: `{{ mustFromYaml "a: [b" }}`, err: "error converting from YAML"},
+		{text: `{{ mustFromJson "{" }}`, err: "error converting from JSON"},
+		{text: `{{ (mustFromJson "{\"a\": 1}").a }}`, want: "1"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		err := tome.Template(&b, tt.text, "test")
+		if tt.err != "" {
+			if assert.Error(t, err, tt.text) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+			continue
+		}
+		if assert.NoError(t, err, tt.text) {
+			assert.Contains(t, b.String(), tt.want, tt.text)
+		}
+	}
+}
+
+func TestFromYamlAll(t *testing.T) {
+	yamlStr := `---
+kind: Service
+---
+---
+kind: Deployment
+spec: {replicas: 2}
+`
+	expected := []any{
+		map[string]any{"kind": "Service"},
+		map[string]any{"kind": "Deployment", "spec": map[string]any{"replicas": 2}},
+	}
+
+	result, err := fromYamlAll(yamlStr)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	_, err = fromYamlAll("a: b\n---\nc: [d\n")
+	assert.Error(t, err)
+}
+
+func TestYamlJsonRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input any
+	}{
+		{name: "map", input: map[string]any{"a": "b", "c": []any{"d", map[string]any{"e": true}}}},
+		{name: "list", input: []any{"a", map[string]any{"b": "c"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yamlStr, err := toYaml(tt.input)
+			assert.NoError(t, err)
+			fromYamlResult, err := mustFromYaml(yamlStr)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.input, fromYamlResult)
+
+			jsonStr, err := toJson(tt.input)
+			assert.NoError(t, err)
+			fromJsonResult, err := mustFromJson(jsonStr)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.input, fromJsonResult)
+		})
+	}
+}
+
 func TestToToml(t *testing.T) {
 	input := map[string]any{
 		"key1": "value1",
@@ -136,8 +279,12 @@ func TestToToml(t *testing.T) {
 	}
 	expected := "key1 = \"value1\"\nkey2 = 42\n"
 
-	result := toToml(input)
+	result, err := toToml(input)
+	assert.NoError(t, err)
 	assert.Equal(t, expected, result)
+
+	_, err = toToml(map[string]any{"f": func() {}})
+	assert.Error(t, err)
 }
 
 func TestFromToml(t *testing.T) {
@@ -171,14 +318,38 @@ func TestToJson(t *testing.T) {
 	assert.JSONEq(t, expected, result)
 }
 
+func TestToJsonSortedKeys(t *testing.T) {
+	input := map[string]any{"b": 1, "a": map[any]any{"d": true, "c": nil}}
+
+	result, err := toJson(input)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":{"c":null,"d":true},"b":1}`, result)
+
+	result, err = toPrettyJson(input)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\n  \"a\": {\n    \"c\": null,\n    \"d\": true\n  },\n  \"b\": 1\n}", result)
+
+	result, err = toPrettyJson(4, []any{1})
+	assert.NoError(t, err)
+	assert.Equal(t, "[\n    1\n]", result)
+
+	for _, indent := range []int{0, -1, 17} {
+		_, err = toPrettyJson(indent, input)
+		assert.Error(t, err, "indent %d", indent)
+	}
+
+	_, err = toJson(map[string]any{"f": func() {}})
+	assert.Error(t, err)
+}
+
 func TestFromJsonMap(t *testing.T) {
 	jsonStr := `{"key1":"value1","key2":42}`
-	expected := map[any]any{
+	expected := map[string]any{
 		"key1": "value1",
 		"key2": float64(42),
 	}
 
-	result, err := fromJson(jsonStr)
+	result, err := mustFromJson(jsonStr)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -187,18 +358,45 @@ func TestFromJsonMap(t *testing.T) {
 
 func TestFromJsonArray(t *testing.T) {
 	jsonStr := `["value1","value2"]`
-	expected := map[any]any{
-		0: "value1",
-		1: "value2",
-	}
+	expected := []any{"value1", "value2"}
 
-	result, err := fromJson(jsonStr)
+	result, err := mustFromJson(jsonStr)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
 	assert.Equal(t, expected, result)
 }
 
+func TestFromJsonArrayVariants(t *testing.T) {
+	result, err := fromJsonArray(`[1, "a", {"b": null}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{float64(1), "a", map[string]any{"b": nil}}, result)
+
+	_, err = fromJsonArray(`{"a": 1}`)
+	assert.Error(t, err)
+
+	_, err = mustFromJson(`"scalar"`)
+	assert.Error(t, err)
+}
+
+func TestFromTomlNested(t *testing.T) {
+	tomlStr := `
+[[servers]]
+name = "web"
+
+[[servers]]
+name = "db"
+`
+	result, err := fromToml(tomlStr)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"servers": []any{
+			map[string]any{"name": "web"},
+			map[string]any{"name": "db"},
+		},
+	}, result)
+}
+
 func TestRequired(t *testing.T) {
 	value := "test"
 	result, err := required(value)
@@ -211,3 +409,184 @@ func TestRequired(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, "no value given for required parameter", err.Error())
 }
+
+func TestSecret(t *testing.T) {
+	t.Setenv("TEMPLAR_TEST_SECRET", "function-secret")
+	tome := &Tome{Values: map[string]any{}}
+
+	var buf bytes.Buffer
+	err := tome.Template(&buf, `{{ secret "TEMPLAR_TEST_SECRET" }}`, "secret.txt")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assert.Equal(t, "function-secret", buf.String())
+
+	err = tome.Template(&buf, `{{ secret "TEMPLAR_TEST_MISSING" }}`, "secret.txt")
+	assert.Error(t, err)
+}
+
+func TestImportContentFromURLSandbox(t *testing.T) {
+	defer func(noNetwork bool, hosts []string, maxSize int64, cacheDir string) {
+		options.NoNetwork, options.AllowHosts, options.HTTPMaxSize, options.HTTPCacheDir = noNetwork, hosts, maxSize, cacheDir
+	}(options.NoNetwork, options.AllowHosts, options.HTTPMaxSize, options.HTTPCacheDir)
+
+	server := httpTestServer([]byte("{{ .msg }}"))
+	defer server.Close()
+	sum := sha256.Sum256([]byte("{{ .msg }}"))
+	pin := "sha256:" + hex.EncodeToString(sum[:])
+
+	rd := RenderDir{Dir: t.TempDir(), Tome: &Tome{Values: map[string]any{"msg": "hello"}}}
+
+	tests := []struct {
+		name      string
+		noNetwork bool
+		hosts     []string
+		maxSize   int64
+		checksum  []any
+		expected  string
+		err       string
+	}{
+		{name: "allowed host", hosts: []string{"127.0.0.*"}, expected: "hello"},
+		{name: "host not allowed", hosts: []string{"example.com"}, err: "not in the allowed hosts"},
+		{name: "network disabled", noNetwork: true, err: "network access is disabled"},
+		{name: "too large", maxSize: 4, err: "exceeds limit of 4 bytes"},
+		{name: "checksum match", checksum: []any{pin}, expected: "hello"},
+		{name: "checksum mismatch", checksum: []any{"sha256:" + strings.Repeat("0", 64)}, err: "checksum mismatch"},
+		{name: "invalid checksum", checksum: []any{"md5:abc"}, err: "unsupported checksum algorithm"},
+		{name: "unsupported algorithm", checksum: []any{"sha1:" + strings.Repeat("0", 40)}, err: "unsupported checksum algorithm"},
+		{name: "misspelled algorithm", checksum: []any{"sah256:" + strings.Repeat("0", 64)}, err: "unsupported checksum algorithm"},
+		{name: "invalid digest", checksum: []any{"sha256:abc"}, err: "invalid sha256 digest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options.NoNetwork, options.AllowHosts, options.HTTPMaxSize, options.HTTPCacheDir = tt.noNetwork, tt.hosts, tt.maxSize, ""
+			result, err := rd.importContent(server.URL, tt.checksum...)
+			if tt.err != "" {
+				assert.Error(t, err)
+				if err != nil {
+					assert.Contains(t, err.Error(), tt.err)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestImportContentFromURLCache(t *testing.T) {
+	defer func(noNetwork bool, cacheDir string) {
+		options.NoNetwork, options.HTTPCacheDir = noNetwork, cacheDir
+	}(options.NoNetwork, options.HTTPCacheDir)
+
+	server := httpTestServer([]byte("{{ .msg }}"))
+	rd := RenderDir{Dir: t.TempDir(), Tome: &Tome{Values: map[string]any{"msg": "cached"}}}
+	options.NoNetwork, options.HTTPCacheDir = false, t.TempDir()
+
+	_, err := rd.importContent(server.URL)
+	assert.NoError(t, err)
+	server.Close()
+
+	// The server is gone, but the content is served from the cache
+	options.NoNetwork = true
+	result, err := rd.importContent(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "cached", result)
+}
+
+func TestImportContentSandbox(t *testing.T) {
+	defer func(sandbox bool) { options.Sandbox = sandbox }(options.Sandbox)
+	options.Sandbox = true
+
+	root := t.TempDir()
+	outside := t.TempDir()
+	extra := t.TempDir()
+	os.WriteFile(filepath.Join(root, "inside.txt"), []byte("inside"), 0644)
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("outside"), 0644)
+	os.WriteFile(filepath.Join(extra, "shared.txt"), []byte("shared"), 0644)
+	os.Mkdir(filepath.Join(root, "sub"), 0755)
+	os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "link.txt"))
+
+	rd := RenderDir{
+		Dir:  filepath.Join(root, "sub"),
+		Tome: &Tome{Source: root, Roots: []string{root, extra}, Values: map[string]any{}},
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+		err      string
+	}{
+		{name: "relative inside", path: "../inside.txt", expected: "inside"},
+		{name: "absolute inside", path: filepath.Join(root, "inside.txt"), expected: "inside"},
+		{name: "extra root", path: filepath.Join(extra, "shared.txt"), expected: "shared"},
+		{name: "dot dot escape", path: "../../" + filepath.Base(outside) + "/secret.txt", err: "outside of the allowed roots"},
+		{name: "absolute escape", path: filepath.Join(outside, "secret.txt"), err: "outside of the allowed roots"},
+		{name: "symlink escape", path: "../link.txt", err: "resolves to"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := rd.importContent(tt.path)
+			if tt.err != "" {
+				assert.Error(t, err)
+				if err != nil {
+					assert.Contains(t, err.Error(), tt.err)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestIncludeVariants(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "chart.yaml"), []byte("name: {{ .Release.Name }}"), 0644)
+	os.WriteFile(filepath.Join(dir, "partial.tpl"), []byte("{{ .name }}={{ .port }}"), 0644)
+
+	rd := RenderDir{
+		Dir: dir,
+		Tome: &Tome{Values: map[string]any{
+			"name": "root",
+			"sub":  map[string]any{"name": "web", "port": 8080},
+		}},
+	}
+
+	raw, err := rd.includeRaw("chart.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "name: {{ .Release.Name }}", raw)
+
+	encoded, err := rd.includeBase64("chart.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte(raw)), encoded)
+
+	read, err := rd.readFile("chart.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, raw, read)
+
+	_, err = rd.readFile("https://example.com/chart.yaml")
+	assert.Error(t, err)
+
+	scoped, err := rd.importContent("partial.tpl", rd.Tome.Values["sub"])
+	assert.NoError(t, err)
+	assert.Equal(t, "web=8080", scoped)
+
+	_, err = rd.importContent("partial.tpl", 1, 2)
+	assert.Error(t, err)
+}
+
+func TestIncludeRawFromURLWithChecksum(t *testing.T) {
+	server := httpTestServer([]byte("{{ raw }}"))
+	defer server.Close()
+	sum := sha256.Sum256([]byte("{{ raw }}"))
+
+	rd := RenderDir{Dir: t.TempDir(), Tome: &Tome{Values: map[string]any{}}}
+	result, err := rd.includeRaw(server.URL, "sha256:"+hex.EncodeToString(sum[:]))
+	assert.NoError(t, err)
+	assert.Equal(t, "{{ raw }}", result)
+
+	_, err = rd.includeRaw(server.URL, "sha256:"+strings.Repeat("0", 64))
+	assert.Error(t, err)
+}
@@ -0,0 +1,417 @@
+package tome
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	mathrand "math/rand/v2"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"templar/internal/options"
+	"templar/internal/values"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultPasswordLength = 24
+	defaultPasswordChars  = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	defaultCertDays       = 365
+)
+
+// seededCertEpoch is when certificates generated with --seed become valid,
+// unless SOURCE_DATE_EPOCH is set, so they do not depend on the time of the run.
+var seededCertEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// generated holds the values created by the generator functions, which are
+// persisted to --state-file so reruns produce identical output.
+var generated = struct {
+	sync.Mutex
+	loaded bool
+	dirty  bool
+	state  map[string]any
+}{}
+
+// generate returns the value stored for key in the state file, or creates it
+// with create. With --seed, create reads from a stream derived from the seed
+// and key, so the same seed creates the same value; otherwise from crypto/rand.
+func generate(key string, create func(r io.Reader) (any, error)) (any, error) {
+	generated.Lock()
+	defer generated.Unlock()
+
+	if !generated.loaded {
+		generated.state = map[string]any{}
+		if options.StateFile != "" {
+			data, err := os.ReadFile(options.StateFile)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("error reading state file: %w", err)
+			}
+			if err := yaml.Unmarshal(data, &generated.state); err != nil {
+				return nil, fmt.Errorf("invalid state file %s: %w", options.StateFile, err)
+			}
+			if generated.state == nil {
+				generated.state = map[string]any{}
+			}
+		}
+		generated.loaded = true
+	}
+	if value, ok := generated.state[key]; ok {
+		return value, nil
+	}
+
+	var r io.Reader = rand.Reader
+	if options.Seed != "" {
+		mac := hmac.New(sha256.New, []byte(options.Seed))
+		mac.Write([]byte(key))
+		var seed [32]byte
+		copy(seed[:], mac.Sum(nil))
+		r = mathrand.NewChaCha8(seed)
+	}
+	value, err := create(r)
+	if err != nil {
+		return nil, err
+	}
+	generated.state[key] = value
+	generated.dirty = true
+	return value, nil
+}
+
+// SaveGenerated writes the generated values to --state-file, if set.
+func SaveGenerated() error {
+	generated.Lock()
+	defer generated.Unlock()
+	if options.StateFile == "" || !generated.dirty || options.DryRun {
+		return nil
+	}
+	data, err := yaml.Marshal(generated.state)
+	if err != nil {
+		return fmt.Errorf("error encoding state file: %w", err)
+	}
+	if err := os.WriteFile(options.StateFile, data, 0600); err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	generated.dirty = false
+	return nil
+}
+
+// generatorKey identifies a generated value by the output file, the kind of
+// value, its name and parameters. The output path is relative to --out, so
+// rendering to another directory produces the same values.
+func (t *Tome) generatorKey(kind, name string, params ...any) string {
+	path := t.output
+	if path != "" && options.Out != "" {
+		if rel, err := filepath.Rel(options.Out, path); err == nil {
+			path = rel
+		}
+	}
+	return fmt.Sprintf("%s:%s:%s:%v", filepath.ToSlash(path), kind, name, params)
+}
+
+// genPassword generates a password of the given length (default 24) from
+// the given characters (default letters and digits).
+func (t *Tome) genPassword(name string, args ...any) (string, error) {
+	length, chars := defaultPasswordLength, defaultPasswordChars
+	switch len(args) {
+	case 2:
+		chars = fmt.Sprint(args[1])
+		fallthrough
+	case 1:
+		n, err := intArg("password length", args[0])
+		if err != nil {
+			return "", err
+		}
+		length = n
+	case 0:
+	default:
+		return "", fmt.Errorf("genPassword accepts a length and characters, got %d arguments", len(args))
+	}
+	if length <= 0 || len(chars) == 0 || len(chars) > 256 {
+		return "", fmt.Errorf("genPassword needs a positive length and 1 to 256 characters")
+	}
+
+	value, err := generate(t.generatorKey("password", name, length, chars), func(r io.Reader) (any, error) {
+		password := make([]byte, length)
+		// Reject bytes above the largest multiple of len(chars) to avoid bias
+		limit := 256 - 256%len(chars)
+		buf := make([]byte, 1)
+		for i := range password {
+			for {
+				if _, err := io.ReadFull(r, buf); err != nil {
+					return nil, err
+				}
+				if int(buf[0]) < limit {
+					password[i] = chars[int(buf[0])%len(chars)]
+					break
+				}
+			}
+		}
+		return string(password), nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error generating password %s: %w", name, err)
+	}
+	values.MarkSensitive(value)
+	return fmt.Sprint(value), nil
+}
+
+// genUUID generates a random (version 4) UUID.
+func (t *Tome) genUUID(name string) (string, error) {
+	value, err := generate(t.generatorKey("uuid", name), func(r io.Reader) (any, error) {
+		var u [16]byte
+		if _, err := io.ReadFull(r, u[:]); err != nil {
+			return nil, err
+		}
+		u[6] = (u[6] & 0x0f) | 0x40
+		u[8] = (u[8] & 0x3f) | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error generating UUID %s: %w", name, err)
+	}
+	return fmt.Sprint(value), nil
+}
+
+// genKeyPair generates a key pair of the given type ("ed25519" (default),
+// "ecdsa" or "rsa") and returns its PEM encoded "private" and "public" keys.
+func (t *Tome) genKeyPair(name string, keyType ...string) (map[string]any, error) {
+	typ := "ed25519"
+	if len(keyType) > 0 {
+		typ = keyType[0]
+	}
+	if typ == "rsa" && options.Seed != "" && options.StateFile == "" {
+		return nil, fmt.Errorf("error generating key pair %s: RSA keys cannot be derived from --seed, use ed25519 or ecdsa, or --state-file", name)
+	}
+	value, err := generate(t.generatorKey("keypair", name, typ), func(r io.Reader) (any, error) {
+		priv, pub, err := newKey(typ, r)
+		if err != nil {
+			return nil, err
+		}
+		privPEM, err := encodePrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		pubDER, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"private": privPEM,
+			"public":  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})),
+		}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error generating key pair %s: %w", name, err)
+	}
+	keys := value.(map[string]any)
+	values.MarkSensitive(keys["private"])
+	return keys, nil
+}
+
+// genCert generates a self-signed ECDSA P-256 certificate for commonName,
+// valid for the given number of days (default 365) and the given DNS names or
+// IP addresses. It returns the PEM encoded "cert" and "key". With --seed, the
+// certificate is valid from SOURCE_DATE_EPOCH, or seededCertEpoch.
+func (t *Tome) genCert(name, commonName string, args ...any) (map[string]any, error) {
+	days := defaultCertDays
+	var sans []string
+	switch len(args) {
+	case 2:
+		list, ok := generic(args[1]).([]any)
+		if !ok {
+			return nil, fmt.Errorf("genCert expects a list of alternative names, got %T", args[1])
+		}
+		for _, san := range list {
+			sans = append(sans, fmt.Sprint(san))
+		}
+		fallthrough
+	case 1:
+		n, err := intArg("number of days", args[0])
+		if err != nil {
+			return nil, err
+		}
+		days = n
+	case 0:
+	default:
+		return nil, fmt.Errorf("genCert accepts a number of days and alternative names, got %d extra arguments", len(args))
+	}
+
+	value, err := generate(t.generatorKey("cert", name, commonName, days, sans), func(r io.Reader) (any, error) {
+		priv, pub, err := newKey("ecdsa", r)
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, 16)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		b[0] = b[0]&0x7f | 0x40 // positive and non-zero
+		serial := new(big.Int).SetBytes(b)
+		notBefore, notAfter, err := certValidity(days)
+		if err != nil {
+			return nil, err
+		}
+		template := &x509.Certificate{
+			SerialNumber:          serial,
+			Subject:               pkix.Name{CommonName: commonName},
+			NotBefore:             notBefore,
+			NotAfter:              notAfter,
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			BasicConstraintsValid: true,
+		}
+		for _, san := range append([]string{commonName}, sans...) {
+			if ip := net.ParseIP(san); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			} else {
+				template.DNSNames = append(template.DNSNames, san)
+			}
+		}
+		signer := ecdsaSigner{priv: priv.(*ecdsa.PrivateKey), r: r}
+		der, err := x509.CreateCertificate(r, template, template, pub, signer)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err := encodePrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"cert": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+			"key":  keyPEM,
+		}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error generating certificate %s: %w", name, err)
+	}
+	cert := value.(map[string]any)
+	values.MarkSensitive(cert["key"])
+	return cert, nil
+}
+
+// certValidity returns the validity period of a generated certificate: the
+// given number of days from the current hour, or with --seed from
+// SOURCE_DATE_EPOCH or seededCertEpoch.
+func certValidity(days int) (time.Time, time.Time, error) {
+	notBefore := time.Now().UTC().Truncate(time.Hour)
+	if options.Seed != "" {
+		notBefore = seededCertEpoch
+		if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+			seconds, err := strconv.ParseInt(epoch, 10, 64)
+			if err != nil {
+				return time.Time{}, time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", epoch, err)
+			}
+			notBefore = time.Unix(seconds, 0).UTC()
+		}
+	}
+	return notBefore, notBefore.AddDate(0, 0, days), nil
+}
+
+// ecdsaSigner signs with an ECDSA key, reading the nonce of each signature
+// from r instead of the standard library's random source, so signatures are
+// reproducible with a seeded reader.
+type ecdsaSigner struct {
+	priv *ecdsa.PrivateKey
+	r    io.Reader
+}
+
+func (s ecdsaSigner) Public() crypto.PublicKey {
+	return &s.priv.PublicKey
+}
+
+func (s ecdsaSigner) Sign(_ io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	curve := s.priv.Curve
+	n := curve.Params().N
+	if len(digest) > (n.BitLen()+7)/8 {
+		digest = digest[:(n.BitLen()+7)/8]
+	}
+	e := new(big.Int).SetBytes(digest)
+	for {
+		k, err := randScalar(curve, s.r)
+		if err != nil {
+			return nil, err
+		}
+		x, _ := curve.ScalarBaseMult(k.FillBytes(make([]byte, (n.BitLen()+7)/8)))
+		r := new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+		// s = k⁻¹(e + r·d) mod n
+		sig := new(big.Int).Mul(r, s.priv.D)
+		sig.Add(sig, e)
+		sig.Mul(sig, new(big.Int).ModInverse(k, n))
+		sig.Mod(sig, n)
+		if sig.Sign() == 0 {
+			continue
+		}
+		return asn1.Marshal(struct{ R, S *big.Int }{r, sig})
+	}
+}
+
+// randScalar reads a scalar in [1, n-1] of curve from r, with negligible
+// bias thanks to 64 extra bits.
+func randScalar(curve elliptic.Curve, r io.Reader) (*big.Int, error) {
+	n := curve.Params().N
+	b := make([]byte, (n.BitLen()+7)/8+8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	d := new(big.Int).SetBytes(b)
+	d.Mod(d, new(big.Int).Sub(n, big.NewInt(1)))
+	return d.Add(d, big.NewInt(1)), nil
+}
+
+// newKey creates a private key reading randomness from r. Ed25519 and ECDSA
+// keys are derived from r directly, so they are reproducible with a seeded
+// reader; the standard library never generates RSA keys deterministically.
+func newKey(typ string, r io.Reader) (any, any, error) {
+	switch typ {
+	case "ed25519":
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := io.ReadFull(r, seed); err != nil {
+			return nil, nil, err
+		}
+		priv := ed25519.NewKeyFromSeed(seed)
+		return priv, priv.Public(), nil
+	case "ecdsa":
+		curve := elliptic.P256()
+		d, err := randScalar(curve, r)
+		if err != nil {
+			return nil, nil, err
+		}
+		priv := &ecdsa.PrivateKey{D: d, PublicKey: ecdsa.PublicKey{Curve: curve}}
+		priv.PublicKey.X, priv.PublicKey.Y = curve.ScalarBaseMult(d.FillBytes(make([]byte, 32)))
+		return priv, &priv.PublicKey, nil
+	case "rsa":
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, nil, err
+		}
+		return priv, &priv.PublicKey, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type %q, expected ed25519, ecdsa or rsa", typ)
+	}
+}
+
+func encodePrivateKey(priv any) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
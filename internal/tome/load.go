@@ -5,37 +5,91 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"templar/internal/options"
+	"templar/internal/secrets"
 	"templar/internal/values"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Mode    string         `yaml:"mode"`
-	Target  string         `yaml:"target"`
-	Strip   []string       `yaml:"strip"`
-	Include []string       `yaml:"include"`
-	Exclude []string       `yaml:"exclude"`
-	Copy    []string       `yaml:"copy"`
-	Temp    []string       `yaml:"temp"`
-	Values  map[string]any `yaml:"values"`
+	Mode     string          `yaml:"mode"`
+	Target   string          `yaml:"target"`
+	Strip    []string        `yaml:"strip"`
+	Include  []string        `yaml:"include"`
+	Exclude  []string        `yaml:"exclude"`
+	Copy     []string        `yaml:"copy"`
+	Temp     []string        `yaml:"temp"`
+	Values   map[string]any  `yaml:"values"`
+	Schema   string          `yaml:"schema"`
+	Secrets  *secrets.Config `yaml:"secrets"`
+	Partials []string        `yaml:"partials"`
+	Delims   []string        `yaml:"delims"`
+
+	TrimBlocks              *bool  `yaml:"trimBlocks"`
+	StripTrailingWhitespace *bool  `yaml:"stripTrailingWhitespace"`
+	CollapseBlankLines      *bool  `yaml:"collapseBlankLines"`
+	EnsureTrailingNewline   *bool  `yaml:"ensureTrailingNewline"`
+	LineEndings             string `yaml:"lineEndings"`
+
+	PostRender     []PostRender      `yaml:"postRender"`
+	ValidateOutput *bool             `yaml:"validateOutput"`
+	OutputSchemas  map[string]string `yaml:"outputSchemas"`
+	Plugins        []PluginConfig    `yaml:"plugins"`
+	Scripts        []string          `yaml:"scripts"`
+	Script         string            `yaml:"script"`
 }
 
-func LoadTomeFile(file string, base *Tome) ([]*Tome, error) {
-	data, err := os.ReadFile(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read tome file: %w", err)
+// whitespace returns the whitespace options of the config, falling back to
+// the ones of base for options that are not set.
+func (c Config) whitespace(base Whitespace) (Whitespace, error) {
+	w := base
+	for _, option := range []struct {
+		value  *bool
+		target *bool
+	}{
+		{c.TrimBlocks, &w.TrimBlocks},
+		{c.StripTrailingWhitespace, &w.StripTrailingWhitespace},
+		{c.CollapseBlankLines, &w.CollapseBlankLines},
+		{c.EnsureTrailingNewline, &w.EnsureTrailingNewline},
+	} {
+		if option.value != nil {
+			*option.target = *option.value
+		}
 	}
-	var templatedData bytes.Buffer
-	err = base.Template(&templatedData, string(data), file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to template tome file: %w", err)
+	if c.LineEndings != "" {
+		w.LineEndings = c.LineEndings
+	}
+	return w, w.validate()
+}
+
+// inheritPatterns sets the strip, include/exclude and copy/temp patterns
+// that are not set in the config to the ones of base.
+func (c *Config) inheritPatterns(base *Tome) {
+	if len(c.Strip) == 0 {
+		c.Strip = base.Strip
+	}
+
+	if len(c.Include) == 0 && len(c.Exclude) == 0 {
+		c.Include = base.Include
+		c.Exclude = base.Exclude
+	}
+
+	if len(c.Copy) == 0 && len(c.Temp) == 0 {
+		c.Copy = base.Copy
+		c.Temp = base.Temp
 	}
+}
+
+// parseTomeConfigs parses a templated tome file holding either a single
+// tome or a list of tomes.
+func parseTomeConfigs(data []byte) ([]Config, error) {
 	var tomeConfig Config
 	var tomeConfigs []Config
-	err = yaml.Unmarshal(templatedData.Bytes(), &tomeConfigs)
+	err := yaml.Unmarshal(data, &tomeConfigs)
 	if err != nil {
-		err = yaml.Unmarshal(templatedData.Bytes(), &tomeConfig)
+		err = yaml.Unmarshal(data, &tomeConfig)
 		if err != nil {
 			return nil, fmt.Errorf("invalid YAML in tome file: %w", err)
 		}
@@ -44,6 +98,23 @@ func LoadTomeFile(file string, base *Tome) ([]*Tome, error) {
 	if len(tomeConfigs) == 0 {
 		return nil, fmt.Errorf("no tomes found in tome file")
 	}
+	return tomeConfigs, nil
+}
+
+func LoadTomeFile(file string, base *Tome) ([]*Tome, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tome file: %w", err)
+	}
+	var templatedData bytes.Buffer
+	err = base.Template(&templatedData, string(data), file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to template tome file: %w", err)
+	}
+	tomeConfigs, err := parseTomeConfigs(templatedData.Bytes())
+	if err != nil {
+		return nil, err
+	}
 
 	dir := filepath.Dir(file)
 	formattedDir, err := base.formatPath(dir)
@@ -61,33 +132,168 @@ func LoadTomeFile(file string, base *Tome) ([]*Tome, error) {
 			return nil, fmt.Errorf("target path must be relative to the tome file directory: %s", tomeConfig.Target)
 		}
 
-		mergedValues := make(map[string]any, len(base.Values))
-		for key, value := range base.Values {
-			mergedValues[key] = value
+		baseValues := base.Values
+		if base.rawValues != nil {
+			baseValues = base.rawValues
+		}
+		// Deep copy, so schema defaults and scripts never write into maps
+		// shared with the parent or sibling tomes
+		mergedValues, _ := values.DeepCopy(baseValues).(map[string]any)
+		if mergedValues == nil {
+			mergedValues = map[string]any{}
 		}
 
 		values.MergeMaps(mergedValues, tomeConfig.Values)
 
-		if len(tomeConfig.Strip) == 0 {
-			tomeConfig.Strip = base.Strip
+		schema := base.Schema
+		if tomeConfig.Schema != "" {
+			schemaPath := tomeConfig.Schema
+			if !filepath.IsAbs(schemaPath) {
+				schemaPath = filepath.Join(dir, schemaPath)
+			}
+			schema, err = values.LoadSchema(schemaPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load schema for tome %d: %w", i+1, err)
+			}
 		}
-
-		if len(tomeConfig.Include) == 0 && len(tomeConfig.Exclude) == 0 {
-			tomeConfig.Include = base.Include
-			tomeConfig.Exclude = base.Exclude
+		values.MarkSensitiveKeys(mergedValues)
+		if schema != nil {
+			schema.ApplyDefaults(mergedValues)
+			schema.MarkSensitive(mergedValues)
 		}
 
-		if len(tomeConfig.Copy) == 0 && len(tomeConfig.Temp) == 0 {
-			tomeConfig.Copy = base.Copy
-			tomeConfig.Temp = base.Temp
-		}
+		tomeConfig.inheritPatterns(base)
 
 		tomes[i], err = New(dir, tomeConfig.Target, tomeConfig.Mode, tomeConfig.Strip,
 			tomeConfig.Include, tomeConfig.Exclude, tomeConfig.Copy, tomeConfig.Temp, mergedValues)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create tome %d: %w", i+1, err)
 		}
+		tomes[i].Schema = schema
+		tomes[i].Delims = base.Delims
+		if len(tomeConfig.Delims) > 0 {
+			if err := ValidateDelims(tomeConfig.Delims); err != nil {
+				return nil, fmt.Errorf("failed to create tome %d: %w", i+1, err)
+			}
+			tomes[i].Delims = tomeConfig.Delims
+		}
+		tomes[i].Whitespace, err = tomeConfig.whitespace(base.Whitespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tome %d: %w", i+1, err)
+		}
+		tomes[i].PostRender = append([]PostRender{}, base.PostRender...)
+		for _, step := range tomeConfig.PostRender {
+			if err := step.validate(); err != nil {
+				return nil, fmt.Errorf("failed to create tome %d: %w", i+1, err)
+			}
+			// Patterns are made absolute, so they keep matching in sub-tomes
+			files := make([]string, len(step.Files))
+			for j, pattern := range step.Files {
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(dir, pattern)
+				}
+				files[j] = pattern
+			}
+			step.Files = files
+			tomes[i].PostRender = append(tomes[i].PostRender, step)
+		}
+		tomes[i].ValidateOutput = base.ValidateOutput
+		if tomeConfig.ValidateOutput != nil {
+			tomes[i].ValidateOutput = *tomeConfig.ValidateOutput
+		}
+		tomes[i].OutputSchemas = append([]OutputSchema{}, base.OutputSchemas...)
+		patterns := make([]string, 0, len(tomeConfig.OutputSchemas))
+		for pattern := range tomeConfig.OutputSchemas {
+			patterns = append(patterns, pattern)
+		}
+		sort.Strings(patterns)
+		for _, pattern := range patterns {
+			schemaPath := tomeConfig.OutputSchemas[pattern]
+			if !filepath.IsAbs(schemaPath) {
+				schemaPath = filepath.Join(dir, schemaPath)
+			}
+			schema, err := values.LoadSchema(schemaPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load output schema for tome %d: %w", i+1, err)
+			}
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(dir, pattern)
+			}
+			tomes[i].OutputSchemas = append(tomes[i].OutputSchemas, OutputSchema{Files: []string{pattern}, Schema: schema})
+		}
+		tomes[i].Roots = base.Roots
+		tomes[i].Partials = base.Partials
+		if err := tomes[i].LoadPartials(tomeConfig.Partials); err != nil {
+			return nil, fmt.Errorf("failed to load partials for tome %d: %w", i+1, err)
+		}
+
+		tomes[i].Secrets = base.Secrets
+		if tomeConfig.Secrets != nil {
+			parent := base.Secrets
+			if parent == nil {
+				parent = newSecretsResolver()
+			}
+			secretsConfig, err := tomes[i].secretsConfig(*tomeConfig.Secrets, dir, file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to configure secrets for tome %d: %w", i+1, err)
+			}
+			tomes[i].Secrets, err = parent.With(secretsConfig, dir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to configure secrets for tome %d: %w", i+1, err)
+			}
+		}
+
+		tomes[i].Plugins = append([]*Plugin{}, base.Plugins...)
+		for _, pluginConfig := range tomeConfig.Plugins {
+			if options.Sandbox {
+				return nil, fmt.Errorf("sandbox: cannot start plugin %s declared in %s", pluginConfig.Name, file)
+			}
+			plugin, err := StartPlugin(pluginConfig, dir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to start plugins for tome %d: %w", i+1, err)
+			}
+			if err := tomes[i].AddPlugins(plugin); err != nil {
+				return nil, fmt.Errorf("failed to start plugins for tome %d: %w", i+1, err)
+			}
+		}
+
+		tomes[i].Scripts = append([]*Script{}, base.Scripts...)
+		for _, path := range tomeConfig.Scripts {
+			script, err := tomes[i].LoadScript(dir, path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load script for tome %d: %w", i+1, err)
+			}
+			if err := tomes[i].AddScripts(script); err != nil {
+				return nil, fmt.Errorf("failed to load script for tome %d: %w", i+1, err)
+			}
+		}
+		if tomeConfig.Script != "" {
+			if err := tomes[i].RunScriptHook(dir, tomeConfig.Script); err != nil {
+				return nil, fmt.Errorf("failed to run script for tome %d: %w", i+1, err)
+			}
+		}
+
+		if options.RenderValues {
+			if err := tomes[i].RenderValues(); err != nil {
+				return nil, fmt.Errorf("failed to render values for tome %d: %w", i+1, err)
+			}
+		}
+
+		// Values are validated as templates see them, after the script hook and rendering
+		if schema != nil {
+			if err := schema.Validate(tomes[i].Values); err != nil {
+				return nil, fmt.Errorf("invalid values for tome %d: %w", i+1, err)
+			}
+		}
 	}
 
 	return tomes, nil
 }
+
+// newSecretsResolver returns a resolver whose file providers load values
+// files like the values given on the command line.
+func newSecretsResolver() *secrets.Resolver {
+	r := secrets.NewResolver()
+	r.SetLoadOptions(values.LoadOptions{NoEnvSubst: options.NoEnvSubst, AgeKeyFile: options.AgeKeyFile})
+	return r
+}
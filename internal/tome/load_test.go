@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"templar/internal/options"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -172,3 +173,143 @@ values:
 		})
 	}
 }
+
+func TestLoadWithSchema(t *testing.T) {
+	tempDir := t.TempDir()
+	schemaFile := filepath.Join(tempDir, "values.schema.json")
+	err := os.WriteFile(schemaFile, []byte(`{
+  "type": "object",
+  "properties": {
+    "replicas": {"type": "integer", "default": 2},
+    "name": {"type": "string"}
+  }
+}`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write schema file: %v", err)
+	}
+
+	base := Tome{Source: filepath.Dir(tempDir), Target: "/tmp", Values: map[string]any{"name": "web"}}
+
+	t.Run("Defaults are applied", func(t *testing.T) {
+		tomeFile := filepath.Join(tempDir, ".tome.yaml")
+		if err := os.WriteFile(tomeFile, []byte("schema: values.schema.json\n"), 0644); err != nil {
+			t.Fatalf("failed to write tome file: %v", err)
+		}
+		tomes, err := LoadTomeFile(tomeFile, &base)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert.Equal(t, 2, tomes[0].Values["replicas"])
+		assert.NotNil(t, tomes[0].Schema)
+	})
+
+	t.Run("Nested defaults do not leak into the parent", func(t *testing.T) {
+		nestedSchema := filepath.Join(tempDir, "nested.schema.json")
+		if err := os.WriteFile(nestedSchema, []byte(`{
+  "type": "object",
+  "properties": {
+    "app": {"type": "object", "properties": {"replicas": {"type": "integer", "default": 3}}}
+  }
+}`), 0644); err != nil {
+			t.Fatalf("failed to write schema file: %v", err)
+		}
+		tomeFile := filepath.Join(tempDir, ".tome.yaml")
+		if err := os.WriteFile(tomeFile, []byte("- schema: nested.schema.json\n- {}\n"), 0644); err != nil {
+			t.Fatalf("failed to write tome file: %v", err)
+		}
+		parent := Tome{Source: filepath.Dir(tempDir), Target: "/tmp", Values: map[string]any{"app": map[string]any{"name": "web"}}}
+		tomes, err := LoadTomeFile(tomeFile, &parent)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert.Equal(t, map[string]any{"name": "web", "replicas": 3}, tomes[0].Values["app"])
+		assert.Equal(t, map[string]any{"name": "web"}, tomes[1].Values["app"])
+		assert.Equal(t, map[string]any{"name": "web"}, parent.Values["app"])
+	})
+
+	t.Run("Invalid overlay is rejected", func(t *testing.T) {
+		tomeFile := filepath.Join(tempDir, ".tome.yaml")
+		if err := os.WriteFile(tomeFile, []byte("schema: values.schema.json\nvalues:\n  replicas: many\n"), 0644); err != nil {
+			t.Fatalf("failed to write tome file: %v", err)
+		}
+		_, err := LoadTomeFile(tomeFile, &base)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "/replicas")
+		}
+	})
+}
+
+func TestLoadWithSecrets(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "secrets.yaml"), []byte("api:\n  key: tome-file-secret\n"), 0600); err != nil {
+		t.Fatalf("failed to write secrets file: %v", err)
+	}
+	tomeFile := filepath.Join(tempDir, ".tome.yaml")
+	err := os.WriteFile(tomeFile, []byte(`
+secrets:
+  default: local
+  providers:
+    local:
+      type: file
+      path: secrets.yaml
+`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write tome file: %v", err)
+	}
+
+	base := Tome{Source: filepath.Dir(tempDir), Target: "/tmp", Values: map[string]any{}}
+	tomes, err := LoadTomeFile(tomeFile, &base)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	value, err := tomes[0].secret("api/key")
+	assert.NoError(t, err)
+	assert.Equal(t, "tome-file-secret", value)
+}
+
+func TestLoadWithSecretsInSandbox(t *testing.T) {
+	defer func(sandbox bool) { options.Sandbox = sandbox }(options.Sandbox)
+	options.Sandbox = true
+
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secrets.yaml"), []byte("api:\n  key: outside\n"), 0600); err != nil {
+		t.Fatalf("failed to write secrets file: %v", err)
+	}
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "secrets.yaml"), []byte("api:\n  key: inside\n"), 0600); err != nil {
+		t.Fatalf("failed to write secrets file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		err      string
+	}{
+		{name: "File inside the roots", provider: "type: file\n      path: secrets.yaml"},
+		{name: "File outside the roots", provider: "type: file\n      path: " + filepath.Join(outside, "secrets.yaml"), err: "outside of the allowed roots"},
+		{name: "Relative file escaping the roots", provider: "type: file\n      path: ../" + filepath.Base(outside) + "/secrets.yaml", err: "outside of the allowed roots"},
+		{name: "Exec provider", provider: "type: exec\n      command: [cat]", err: "sandbox: cannot run secret provider local"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tomeFile := filepath.Join(source, ".tome.yaml")
+			content := "secrets:\n  default: local\n  providers:\n    local:\n      " + tt.provider + "\n"
+			if err := os.WriteFile(tomeFile, []byte(content), 0644); err != nil {
+				t.Fatalf("failed to write tome file: %v", err)
+			}
+			base := Tome{Source: source, Target: "/tmp", Values: map[string]any{}}
+			tomes, err := LoadTomeFile(tomeFile, &base)
+			if tt.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.err)
+				}
+				return
+			}
+			if assert.NoError(t, err) {
+				value, err := tomes[0].secret("api/key")
+				assert.NoError(t, err)
+				assert.Equal(t, "inside", value)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package tome
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// maxPortRange bounds portRange so a typo cannot create a huge list.
+const maxPortRange = 65536
+
+// cidrHost returns the IP address of host number hostnum in prefix, counting
+// from the end of the prefix if hostnum is negative.
+func cidrHost(prefix string, hostnum any) (string, error) {
+	p, err := parsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	n, err := intArg("host number", hostnum)
+	if err != nil {
+		return "", err
+	}
+	size := new(big.Int).Lsh(big.NewInt(1), uint(p.Addr().BitLen()-p.Bits()))
+	num := big.NewInt(int64(n))
+	if n < 0 {
+		num.Add(num, size)
+	}
+	if num.Sign() < 0 || num.Cmp(size) >= 0 {
+		return "", fmt.Errorf("prefix %s has no host number %d", prefix, n)
+	}
+	return offsetAddr(p.Addr(), num).String(), nil
+}
+
+// cidrSubnet returns subnet netnum of prefix, extended by newbits bits.
+func cidrSubnet(prefix string, newbits, netnum any) (string, error) {
+	p, err := parsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	nb, err := intArg("new bits", newbits)
+	if err != nil {
+		return "", err
+	}
+	n, err := intArg("network number", netnum)
+	if err != nil {
+		return "", err
+	}
+	length := p.Bits() + nb
+	if nb < 0 || length > p.Addr().BitLen() {
+		return "", fmt.Errorf("cannot extend prefix %s by %d bits", prefix, nb)
+	}
+	if n < 0 || big.NewInt(int64(n)).BitLen() > nb {
+		return "", fmt.Errorf("prefix %s extended by %d bits has no network number %d", prefix, nb, n)
+	}
+	offset := new(big.Int).Lsh(big.NewInt(int64(n)), uint(p.Addr().BitLen()-length))
+	return netip.PrefixFrom(offsetAddr(p.Addr(), offset), length).String(), nil
+}
+
+// cidrSubnets allocates consecutive subnets of prefix, each extended by the
+// given number of bits, like Terraform's cidrsubnets.
+func cidrSubnets(prefix string, newbits ...any) ([]string, error) {
+	p, err := parsePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	bitLen := p.Addr().BitLen()
+	end := new(big.Int).Lsh(big.NewInt(1), uint(bitLen-p.Bits()))
+	next := new(big.Int)
+	subnets := make([]string, 0, len(newbits))
+	for _, arg := range newbits {
+		nb, err := intArg("new bits", arg)
+		if err != nil {
+			return nil, err
+		}
+		length := p.Bits() + nb
+		if nb <= 0 || length > bitLen {
+			return nil, fmt.Errorf("cannot extend prefix %s by %d bits", prefix, nb)
+		}
+		// Align the subnet to its own size
+		size := new(big.Int).Lsh(big.NewInt(1), uint(bitLen-length))
+		rem := new(big.Int).Mod(next, size)
+		if rem.Sign() != 0 {
+			next.Add(next, size).Sub(next, rem)
+		}
+		if new(big.Int).Add(next, size).Cmp(end) > 0 {
+			return nil, fmt.Errorf("not enough space in prefix %s for all subnets", prefix)
+		}
+		subnets = append(subnets, netip.PrefixFrom(offsetAddr(p.Addr(), next), length).String())
+		next.Add(next, size)
+	}
+	return subnets, nil
+}
+
+// cidrNetmask returns the dotted netmask of an IPv4 prefix.
+func cidrNetmask(prefix string) (string, error) {
+	p, err := parsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	if !p.Addr().Is4() {
+		return "", fmt.Errorf("netmasks are only supported for IPv4 prefixes, got %s", prefix)
+	}
+	return net.IP(net.CIDRMask(p.Bits(), 32)).String(), nil
+}
+
+// cidrContains reports whether prefix contains an IP address or another prefix.
+func cidrContains(prefix, ipOrPrefix string) (bool, error) {
+	p, err := parsePrefix(prefix)
+	if err != nil {
+		return false, err
+	}
+	if strings.Contains(ipOrPrefix, "/") {
+		other, err := parsePrefix(ipOrPrefix)
+		if err != nil {
+			return false, err
+		}
+		return other.Bits() >= p.Bits() && p.Contains(other.Addr()), nil
+	}
+	addr, err := parseAddr(ipOrPrefix)
+	if err != nil {
+		return false, err
+	}
+	return p.Contains(addr), nil
+}
+
+// parseIP returns the canonical form of an IP address.
+func parseIP(ip string) (string, error) {
+	addr, err := parseAddr(ip)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// ipFamily returns "ipv4" or "ipv6" for an IP address or prefix.
+func ipFamily(ip string) (string, error) {
+	var addr netip.Addr
+	if strings.Contains(ip, "/") {
+		p, err := parsePrefix(ip)
+		if err != nil {
+			return "", err
+		}
+		addr = p.Addr()
+	} else {
+		var err error
+		if addr, err = parseAddr(ip); err != nil {
+			return "", err
+		}
+	}
+	if addr.Is4() {
+		return "ipv4", nil
+	}
+	return "ipv6", nil
+}
+
+// isIPv4 reports whether s is an IPv4 address.
+func isIPv4(s string) bool {
+	addr, err := parseAddr(s)
+	return err == nil && addr.Is4()
+}
+
+// isIPv6 reports whether s is an IPv6 address.
+func isIPv6(s string) bool {
+	addr, err := parseAddr(s)
+	return err == nil && addr.Is6()
+}
+
+// portRange expands port specifications like "80", "8000-8003" or
+// "80,443,8000-8002" into a list of ports.
+func portRange(spec any) ([]int, error) {
+	ports := []int{}
+	for _, part := range strings.Split(fmt.Sprint(spec), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := parsePort(first)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			if end, err = parsePort(last); err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid port range %s", part)
+			}
+		}
+		if len(ports)+end-start+1 > maxPortRange {
+			return nil, fmt.Errorf("port specification %v expands to more than %d ports", spec, maxPortRange)
+		}
+		for port := start; port <= end; port++ {
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port < 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR prefix %q: %w", s, err)
+	}
+	return p.Masked(), nil
+}
+
+func parseAddr(s string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid IP address %q: %w", s, err)
+	}
+	return addr.Unmap(), nil
+}
+
+// offsetAddr adds offset to addr.
+func offsetAddr(addr netip.Addr, offset *big.Int) netip.Addr {
+	n := new(big.Int).SetBytes(addr.AsSlice())
+	n.Add(n, offset)
+	b := make([]byte, addr.BitLen()/8)
+	n.FillBytes(b)
+	result, _ := netip.AddrFromSlice(b)
+	return result
+}
+
+// intArg converts a numeric template argument, which may come from values
+// as any integer or float type or as a string, to an int.
+func intArg(name string, v any) (int, error) {
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case int8:
+		return int(v), nil
+	case int16:
+		return int(v), nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case uint8:
+		return int(v), nil
+	case uint16:
+		return int(v), nil
+	case uint32:
+		return int(v), nil
+	case uint64:
+		if v <= math.MaxInt {
+			return int(v), nil
+		}
+	case uint:
+		if v <= math.MaxInt {
+			return int(v), nil
+		}
+	case float64:
+		if v == math.Trunc(v) {
+			return int(v), nil
+		}
+	case float32:
+		if float64(v) == math.Trunc(float64(v)) {
+			return int(v), nil
+		}
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid %s %v", name, v)
+}
@@ -0,0 +1,141 @@
+package tome
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCidrHost(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		hostnum  any
+		expected string
+		err      bool
+	}{
+		{prefix: "10.12.112.0/20", hostnum: 16, expected: "10.12.112.16"},
+		{prefix: "10.12.112.0/20", hostnum: 268, expected: "10.12.113.12"},
+		{prefix: "10.12.112.0/20", hostnum: float64(268), expected: "10.12.113.12"},
+		{prefix: "10.0.0.0/24", hostnum: -1, expected: "10.0.0.255"},
+		{prefix: "10.0.0.7/24", hostnum: "1", expected: "10.0.0.1"},
+		{prefix: "fd00:fd12:3456:7890:00a2::/72", hostnum: 34, expected: "fd00:fd12:3456:7890::22"},
+		{prefix: "10.0.0.0/24", hostnum: 256, err: true},
+		{prefix: "10.0.0.0/24", hostnum: -257, err: true},
+		{prefix: "10.0.0.0/24", hostnum: 1.5, err: true},
+		{prefix: "10.0.0.0", hostnum: 1, err: true},
+	}
+	for _, tt := range tests {
+		result, err := cidrHost(tt.prefix, tt.hostnum)
+		if tt.err {
+			assert.Error(t, err, "%s %v", tt.prefix, tt.hostnum)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, result)
+	}
+}
+
+func TestCidrSubnet(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		newbits  int
+		netnum   int
+		expected string
+		err      bool
+	}{
+		{prefix: "172.16.0.0/12", newbits: 4, netnum: 2, expected: "172.18.0.0/16"},
+		{prefix: "10.1.2.0/24", newbits: 4, netnum: 15, expected: "10.1.2.240/28"},
+		{prefix: "fd00:fd12:3456:7890::/56", newbits: 16, netnum: 162, expected: "fd00:fd12:3456:7800:a200::/72"},
+		{prefix: "10.1.2.0/24", newbits: 4, netnum: 16, err: true},
+		{prefix: "10.1.2.0/24", newbits: 9, netnum: 0, err: true},
+	}
+	for _, tt := range tests {
+		result, err := cidrSubnet(tt.prefix, tt.newbits, tt.netnum)
+		if tt.err {
+			assert.Error(t, err, "%s %d %d", tt.prefix, tt.newbits, tt.netnum)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, result)
+	}
+}
+
+func TestCidrSubnets(t *testing.T) {
+	result, err := cidrSubnets("10.1.0.0/16", 4, 4, 8, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.1.0.0/20", "10.1.16.0/20", "10.1.32.0/24", "10.1.48.0/20"}, result)
+
+	_, err = cidrSubnets("10.1.0.0/24", 1, 1, 1)
+	assert.Error(t, err)
+}
+
+func TestCidrNetmaskAndContains(t *testing.T) {
+	mask, err := cidrNetmask("172.16.0.0/12")
+	assert.NoError(t, err)
+	assert.Equal(t, "255.240.0.0", mask)
+	_, err = cidrNetmask("fd00::/8")
+	assert.Error(t, err)
+
+	for _, tt := range []struct {
+		prefix, other string
+		expected      bool
+	}{
+		{"10.0.0.0/8", "10.1.2.3", true},
+		{"10.0.0.0/8", "11.0.0.1", false},
+		{"10.0.0.0/8", "10.1.0.0/16", true},
+		{"10.1.0.0/16", "10.0.0.0/8", false},
+		{"fd00::/8", "fd12::1", true},
+		{"10.0.0.0/8", "::ffff:10.0.0.1", true},
+	} {
+		contains, err := cidrContains(tt.prefix, tt.other)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, contains, "%s contains %s", tt.prefix, tt.other)
+	}
+	_, err = cidrContains("10.0.0.0/8", "not-an-ip")
+	assert.Error(t, err)
+}
+
+func TestIPFunctions(t *testing.T) {
+	ip, err := parseIP("2001:0db8:0000:0000:0000:0000:0000:0001")
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", ip)
+	_, err = parseIP("300.1.1.1")
+	assert.Error(t, err)
+
+	family, err := ipFamily("192.168.1.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "ipv4", family)
+	family, err = ipFamily("fd00::/8")
+	assert.NoError(t, err)
+	assert.Equal(t, "ipv6", family)
+
+	assert.True(t, isIPv4("127.0.0.1"))
+	assert.False(t, isIPv4("::1"))
+	assert.True(t, isIPv6("::1"))
+	assert.False(t, isIPv6("localhost"))
+}
+
+func TestPortRange(t *testing.T) {
+	tests := []struct {
+		spec     any
+		expected []int
+		err      bool
+	}{
+		{spec: 80, expected: []int{80}},
+		{spec: "8000-8003", expected: []int{8000, 8001, 8002, 8003}},
+		{spec: "80, 443,9000-9001", expected: []int{80, 443, 9000, 9001}},
+		{spec: "", expected: []int{}},
+		{spec: "90-80", err: true},
+		{spec: "70000", err: true},
+		{spec: "http", err: true},
+	}
+	for _, tt := range tests {
+		result, err := portRange(tt.spec)
+		if tt.err {
+			assert.Error(t, err, "%v", tt.spec)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, result)
+	}
+}
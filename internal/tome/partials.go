@@ -0,0 +1,113 @@
+package tome
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// partialPattern matches the base name of files treated as partials.
+const partialPattern = "_*.tpl"
+
+// LoadPartials adds the partial templates of the tome to the ones inherited
+// from its parent: files named "_*.tpl" below the tome's source directory
+// that would be templated (excluding directories of sub-tomes and copied
+// files) and files matching patterns, which are relative to the source
+// directory. With --sandbox, patterns and partials must stay inside the
+// tome's roots.
+func (t *Tome) LoadPartials(patterns []string) error {
+	seen := make(map[string]bool, len(t.Partials))
+	partials := append([]string{}, t.Partials...)
+	for _, partial := range partials {
+		seen[partial] = true
+	}
+	rd := &RenderDir{Dir: t.Source, Tome: t}
+	add := func(path string) error {
+		if _, err := rd.resolvePath(path); err != nil {
+			return fmt.Errorf("partial %s: %w", path, err)
+		}
+		if !seen[path] {
+			seen[path] = true
+			partials = append(partials, path)
+		}
+		return nil
+	}
+
+	err := filepath.WalkDir(t.Source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != t.Source {
+				if _, err := os.Stat(filepath.Join(path, ".tome.yaml")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if matched, _ := filepath.Match(partialPattern, d.Name()); matched && t.ShouldInclude(path) && !t.shouldCopy(path) {
+			return add(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error finding partials: %w", err)
+	}
+
+	for _, pattern := range patterns {
+		pattern, err := rd.resolvePath(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid partials pattern: %w", err)
+		}
+		matches, err := doublestar.FilepathGlob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid partials pattern %s: %w", pattern, err)
+		}
+		for _, match := range matches {
+			if err := add(match); err != nil {
+				return err
+			}
+		}
+	}
+
+	t.Partials = partials
+	t.partials = nil
+	return nil
+}
+
+// isPartial reports whether a file is a partial, which is never rendered as
+// output. Files named "_*.tpl" that are copied as-is are not partials.
+func (t *Tome) isPartial(path string) bool {
+	if matched, _ := filepath.Match(partialPattern, filepath.Base(path)); matched && !t.shouldCopy(path) {
+		return true
+	}
+	for _, partial := range t.Partials {
+		if partial == path {
+			return true
+		}
+	}
+	return false
+}
+
+// partialTemplates returns a fresh copy of the template set holding the
+// tome's partials, parsing them on first use.
+func (t *Tome) partialTemplates() (*template.Template, error) {
+	if t.partials == nil {
+		set := template.New("").Funcs(t.funcMap(t.Source))
+		for _, path := range t.Partials {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("error reading partial %s: %w", path, err)
+			}
+			if _, err := t.parse(set.New(path), string(content)); err != nil {
+				return nil, fmt.Errorf("error parsing partial: %w", err)
+			}
+		}
+		t.partials = set
+	}
+	return t.partials.Clone()
+}
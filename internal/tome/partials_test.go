@@ -0,0 +1,145 @@
+package tome
+
+import (
+	"os"
+	"path/filepath"
+	"templar/internal/options"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderWithPartials(t *testing.T) {
+	in := t.TempDir()
+	out := t.TempDir()
+	files := map[string]string{
+		"_helpers.tpl":         `{{ define "name" }}app-{{ .name }}{{ end }}`,
+		"main.txt":             `{{ template "name" . }}`,
+		"sub/.tome.yaml":       "partials:\n  - lib/*.tmpl\n",
+		"sub/lib/labels.tmpl":  `{{ define "labels" }}name={{ template "name" . }}{{ end }}`,
+		"sub/config.txt":       `{{ template "labels" . }}`,
+		"sub/_local.tpl":       `{{ define "local" }}local{{ end }}`,
+		"sub/local.txt":        `{{ template "local" }}`,
+		"sub/override.txt":     `{{ define "name" }}custom{{ end }}{{ template "name" . }}`,
+		"other/uses-local.txt": `{{ template "name" . }}`,
+	}
+	writeTree(t, in, files)
+
+	base, err := New(in, out, "", nil, nil, nil, nil, nil, map[string]any{"name": "web"})
+	if err != nil {
+		t.Fatalf("failed to create tome: %v", err)
+	}
+	if err := base.LoadPartials(nil); err != nil {
+		t.Fatalf("failed to load partials: %v", err)
+	}
+	// Partials of sub-tome directories belong to the sub-tome only
+	assert.Equal(t, []string{filepath.Join(in, "_helpers.tpl")}, base.Partials)
+
+	if err := base.Render(in); err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+
+	expected := map[string]string{
+		"main.txt":             "app-web",
+		"sub/config.txt":       "name=app-web",
+		"sub/local.txt":        "local",
+		"sub/override.txt":     "custom",
+		"other/uses-local.txt": "app-web",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(out, name))
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, content, string(data), name)
+		}
+	}
+	for _, name := range []string{"_helpers.tpl", "sub/_local.tpl", "sub/lib/labels.tmpl"} {
+		_, err := os.Stat(filepath.Join(out, name))
+		assert.True(t, os.IsNotExist(err), "partial %s must not be rendered", name)
+	}
+}
+
+func TestCopiedPartialsAreNotParsed(t *testing.T) {
+	in := t.TempDir()
+	out := t.TempDir()
+	helpers := `{{- define "chart.name" -}}{{ lookup "v1" "Secret" "" "" }}{{- end -}}`
+	files := map[string]string{
+		"chart/templates/_helpers.tpl": helpers,
+		"chart/values.yaml":            "name: {{ .Values.name }}",
+		"config.txt":                   "{{ .name }}",
+	}
+	writeTree(t, in, files)
+
+	base, err := New(in, out, "", nil, nil, nil, []string{"chart/**"}, nil, map[string]any{"name": "web"})
+	if err != nil {
+		t.Fatalf("failed to create tome: %v", err)
+	}
+	if err := base.LoadPartials(nil); err != nil {
+		t.Fatalf("failed to load partials: %v", err)
+	}
+	assert.Empty(t, base.Partials, "copied files are not partials")
+
+	if err := base.Render(in); err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	expected := map[string]string{
+		"chart/templates/_helpers.tpl": helpers,
+		"chart/values.yaml":            "name: {{ .Values.name }}",
+		"config.txt":                   "web",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(out, name))
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, content, string(data), name)
+		}
+	}
+}
+
+func TestLoadPartialsSandbox(t *testing.T) {
+	defer func(sandbox bool) { options.Sandbox = sandbox }(options.Sandbox)
+	options.Sandbox = true
+
+	parent := t.TempDir()
+	in := filepath.Join(parent, "templates")
+	outside := filepath.Join(parent, "outside")
+	writeTree(t, parent, map[string]string{
+		"templates/lib/labels.tmpl": `{{ define "labels" }}app{{ end }}`,
+		"outside/secret.txt":        "top secret",
+	})
+
+	newTome := func() *Tome {
+		tome, err := New(in, t.TempDir(), "", nil, nil, nil, nil, nil, map[string]any{})
+		if err != nil {
+			t.Fatalf("failed to create tome: %v", err)
+		}
+		tome.Roots = []string{in}
+		return tome
+	}
+
+	for _, pattern := range []string{filepath.Join(outside, "secret.txt"), "../outside/*.txt", "lib/../../outside/**"} {
+		t.Run(pattern, func(t *testing.T) {
+			err := newTome().LoadPartials([]string{pattern})
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "sandbox")
+			}
+		})
+	}
+
+	t.Run("Symlinked partial", func(t *testing.T) {
+		link := filepath.Join(in, "lib", "link.tmpl")
+		if err := os.Symlink(filepath.Join(outside, "secret.txt"), link); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+		defer os.Remove(link)
+		err := newTome().LoadPartials([]string{"lib/*.tmpl"})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "sandbox")
+		}
+	})
+
+	t.Run("Patterns inside the roots", func(t *testing.T) {
+		tome := newTome()
+		if assert.NoError(t, tome.LoadPartials([]string{"lib/*.tmpl"})) {
+			assert.Equal(t, []string{filepath.Join(in, "lib", "labels.tmpl")}, tome.Partials)
+		}
+	})
+}
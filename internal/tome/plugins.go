@@ -0,0 +1,314 @@
+package tome
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// PluginConfig declares an executable plugin providing template functions.
+// A relative command path is relative to the file declaring the plugin.
+type PluginConfig struct {
+	Name    string   `yaml:"name"`
+	Command []string `yaml:"command"`
+}
+
+// pluginRequest is a message sent to a plugin on its standard input, one
+// JSON object per line. The "functions" method asks for the names of the
+// functions the plugin provides, "call" calls one of them with args.
+type pluginRequest struct {
+	Method   string `json:"method"`
+	Function string `json:"function,omitempty"`
+	Args     []any  `json:"args,omitempty"`
+}
+
+// pluginResponse is the answer of a plugin to a request, one JSON object
+// per line on its standard output.
+type pluginResponse struct {
+	Functions []string        `json:"functions,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// Plugin is a running plugin process. Calls are serialized.
+type Plugin struct {
+	Name      string
+	Functions []string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// plugins holds the running plugin processes by command line, so tomes
+// declaring the same plugin share one process.
+var plugins = struct {
+	sync.Mutex
+	running map[string]*Plugin
+}{running: map[string]*Plugin{}}
+
+// pluginTimeout bounds how long a plugin may take to answer a request.
+var pluginTimeout = 30 * time.Second
+
+// registered holds the functions added with RegisterFunc.
+var registered = struct {
+	sync.Mutex
+	funcs template.FuncMap
+}{funcs: template.FuncMap{}}
+
+// funcNamePattern matches the names template functions can have.
+var funcNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// RegisterFunc adds a Go function to the functions available in templates.
+// fn must return one value, or a value and an error. Programs built with this
+// module call it through the templar/pkg/templar package. It fails if name is
+// taken by a Sprig, built-in or other registered function.
+func RegisterFunc(name string, fn any) error {
+	if err := checkFuncName(name, (&Tome{}).funcMap("")); err != nil {
+		return err
+	}
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func {
+		return fmt.Errorf("cannot register %s: %T is not a function", name, fn)
+	}
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	if t.NumOut() == 0 || t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errorType) {
+		return fmt.Errorf("cannot register %s: a function must return a value, or a value and an error", name)
+	}
+	registered.Lock()
+	defer registered.Unlock()
+	if _, ok := registered.funcs[name]; ok {
+		return fmt.Errorf("function %s is already defined", name)
+	}
+	registered.funcs[name] = fn
+	return nil
+}
+
+// RegisterFuncs adds every function of funcs, see RegisterFunc.
+func RegisterFuncs(funcs template.FuncMap) error {
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := RegisterFunc(name, funcs[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkFuncName fails if name cannot be used for a template function or is
+// already in funcs.
+func checkFuncName(name string, funcs template.FuncMap) error {
+	if !funcNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid function name %q", name)
+	}
+	if _, ok := sprig.TxtFuncMap()[name]; ok {
+		return fmt.Errorf("function %s collides with a Sprig function", name)
+	}
+	if _, ok := funcs[name]; ok {
+		return fmt.Errorf("function %s is already defined", name)
+	}
+	return nil
+}
+
+// AddPlugins makes the functions of plugins available to the tome's
+// templates, failing if one collides with an existing function.
+func (t *Tome) AddPlugins(plugins ...*Plugin) error {
+	for _, p := range plugins {
+		funcs := t.funcMap("")
+		for _, name := range p.Functions {
+			if err := checkFuncName(name, funcs); err != nil {
+				return fmt.Errorf("plugin %s: %w", p.Name, err)
+			}
+		}
+		t.Plugins = append(t.Plugins, p)
+	}
+	t.partials = nil
+	return nil
+}
+
+// LoadPluginsFile starts the plugins declared under "plugins" in a YAML file.
+func LoadPluginsFile(file string) ([]*Plugin, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugins file: %w", err)
+	}
+	var config struct {
+		Plugins []PluginConfig `yaml:"plugins"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid YAML in plugins file %s: %w", file, err)
+	}
+	var started []*Plugin
+	for _, c := range config.Plugins {
+		p, err := StartPlugin(c, filepath.Dir(file))
+		if err != nil {
+			return nil, err
+		}
+		started = append(started, p)
+	}
+	return started, nil
+}
+
+// StartPlugin starts the plugin declared by config, or returns the running
+// process of the same command, and asks it for its functions.
+func StartPlugin(config PluginConfig, dir string) (*Plugin, error) {
+	if len(config.Command) == 0 {
+		return nil, fmt.Errorf("plugin %s has no command", config.Name)
+	}
+	command := append([]string{}, config.Command...)
+	if strings.ContainsRune(command[0], filepath.Separator) && !filepath.IsAbs(command[0]) {
+		command[0] = filepath.Join(dir, command[0])
+	}
+	name := config.Name
+	if name == "" {
+		name = filepath.Base(command[0])
+	}
+
+	plugins.Lock()
+	defer plugins.Unlock()
+	key := strings.Join(command, "\x00")
+	if p, ok := plugins.running[key]; ok {
+		return p, nil
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", name, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", name, err)
+	}
+	p := &Plugin{Name: name, cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}
+
+	resp, err := p.request(pluginRequest{Method: "functions"})
+	if err != nil {
+		p.close()
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, fn := range resp.Functions {
+		if !funcNamePattern.MatchString(fn) || seen[fn] {
+			p.close()
+			return nil, fmt.Errorf("plugin %s: invalid or duplicate function name %q", name, fn)
+		}
+		seen[fn] = true
+	}
+	p.Functions = resp.Functions
+	plugins.running[key] = p
+	return p, nil
+}
+
+// request sends a request to the plugin and reads its response. A plugin
+// not answering within pluginTimeout is killed.
+func (p *Plugin) request(req pluginRequest) (*pluginResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: cannot encode arguments: %w", p.Name, err)
+	}
+
+	type result struct {
+		line []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		if _, err := p.stdin.Write(append(data, '\n')); err != nil {
+			done <- result{err: err}
+			return
+		}
+		line, err := p.stdout.ReadBytes('\n')
+		done <- result{line, err}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-time.After(pluginTimeout):
+		p.cmd.Process.Kill()
+		<-done
+		return nil, fmt.Errorf("plugin %s did not respond within %s", p.Name, pluginTimeout)
+	}
+
+	line, err := res.line, res.err
+	if err != nil && (!errors.Is(err, io.EOF) || len(line) == 0) {
+		return nil, fmt.Errorf("plugin %s did not respond: %w", p.Name, err)
+	}
+	var resp pluginResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("plugin %s: invalid response: %w", p.Name, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("plugin %s: %s", p.Name, resp.Error)
+	}
+	return &resp, nil
+}
+
+// function returns the template function calling fn of the plugin.
+func (p *Plugin) function(fn string) func(args ...any) (any, error) {
+	return func(args ...any) (any, error) {
+		for i, arg := range args {
+			args[i] = generic(arg)
+		}
+		resp, err := p.request(pluginRequest{Method: "call", Function: fn, Args: args})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		if len(resp.Result) == 0 {
+			return nil, nil
+		}
+		var result any
+		decoder := json.NewDecoder(strings.NewReader(string(resp.Result)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&result); err != nil {
+			return nil, fmt.Errorf("%s: invalid result from plugin %s: %w", fn, p.Name, err)
+		}
+		return jqValue(result), nil
+	}
+}
+
+// close ends the plugin process by closing its standard input.
+func (p *Plugin) close() error {
+	p.stdin.Close()
+	return p.cmd.Wait()
+}
+
+// ClosePlugins stops all running plugins.
+func ClosePlugins() error {
+	plugins.Lock()
+	defer plugins.Unlock()
+	var errs []error
+	for key, p := range plugins.running {
+		if err := p.close(); err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: %w", p.Name, err))
+		}
+		delete(plugins.running, key)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,208 @@
+package tome
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"templar/internal/options"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain lets the test binary act as a plugin when started by the tests.
+func TestMain(m *testing.M) {
+	if os.Getenv("TEMPLAR_TEST_PLUGIN") != "" {
+		servePlugin(strings.Split(os.Getenv("TEMPLAR_TEST_PLUGIN"), ","))
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// servePlugin answers plugin requests with the given functions: "shout"
+// upper-cases its argument, "total" sums numbers, "hang" never answers and
+// any other function fails.
+func servePlugin(functions []string) {
+	scanner := bufio.NewScanner(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		var req pluginRequest
+		json.Unmarshal(scanner.Bytes(), &req)
+		resp := map[string]any{}
+		switch {
+		case req.Method == "functions":
+			resp["functions"] = functions
+		case req.Function == "shout":
+			resp["result"] = strings.ToUpper(fmt.Sprint(req.Args...)) + "!"
+		case req.Function == "total":
+			sum := 0.0
+			for _, arg := range req.Args {
+				sum += arg.(float64)
+			}
+			resp["result"] = sum
+		case req.Function == "hang":
+			time.Sleep(time.Hour)
+		default:
+			resp["error"] = "unknown function " + req.Function
+		}
+		encoder.Encode(resp)
+	}
+}
+
+// testPlugin returns the config of a plugin running the test binary with functions.
+func testPlugin(t *testing.T, name string, functions string) PluginConfig {
+	t.Setenv("TEMPLAR_TEST_PLUGIN", functions)
+	return PluginConfig{Name: name, Command: []string{os.Args[0], "-test.run=^$", "-plugin=" + name}}
+}
+
+func TestPlugins(t *testing.T) {
+	defer ClosePlugins()
+	plugin, err := StartPlugin(testPlugin(t, "text", "shout,total,broken"), "")
+	if err != nil {
+		t.Fatalf("failed to start plugin: %v", err)
+	}
+	assert.Equal(t, []string{"shout", "total", "broken"}, plugin.Functions)
+
+	same, err := StartPlugin(testPlugin(t, "text", "shout,total,broken"), "")
+	if assert.NoError(t, err) {
+		assert.Same(t, plugin, same, "plugins with the same command share one process")
+	}
+
+	tome := &Tome{Values: map[string]any{"name": "web", "ports": []any{80, 443}}}
+	if err := tome.AddPlugins(plugin); err != nil {
+		t.Fatalf("failed to add plugin: %v", err)
+	}
+	tests := []struct {
+		text     string
+		expected string
+		err      string
+	}{
+		{text: `{{ shout .name }}`, expected: "WEB!"},
+		{text: `{{ total 1 2.5 | printf "%v" }}`, expected: "3.5"},
+		{text: `{{ total 40 2 | total 1 }}`, expected: "43"},
+		{text: `{{ broken }}`, err: "plugin text: unknown function broken"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		err := tome.Template(&b, tt.text, "test")
+		if tt.err != "" {
+			if assert.Error(t, err, tt.text) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+			continue
+		}
+		if assert.NoError(t, err, tt.text) {
+			assert.Equal(t, tt.expected, b.String(), tt.text)
+		}
+	}
+}
+
+func TestPluginCollisions(t *testing.T) {
+	defer ClosePlugins()
+	tests := []struct {
+		functions string
+		err       string
+	}{
+		{functions: "upper", err: "function upper collides with a Sprig function"},
+		{functions: "include", err: "function include is already defined"},
+		{functions: "shout", err: "function shout is already defined"},
+		{functions: "bad-name", err: `invalid or duplicate function name "bad-name"`},
+		{functions: "dup,dup", err: `invalid or duplicate function name "dup"`},
+	}
+	tome := &Tome{}
+	first, err := StartPlugin(testPlugin(t, "first", "shout"), "")
+	if err != nil {
+		t.Fatalf("failed to start plugin: %v", err)
+	}
+	assert.NoError(t, tome.AddPlugins(first))
+	for i, tt := range tests {
+		plugin, err := StartPlugin(testPlugin(t, fmt.Sprint("plugin", i), tt.functions), "")
+		if err == nil {
+			err = tome.AddPlugins(plugin)
+		}
+		if assert.Error(t, err, tt.functions) {
+			assert.Contains(t, err.Error(), tt.err)
+		}
+	}
+}
+
+func TestPluginTimeout(t *testing.T) {
+	defer ClosePlugins()
+	defer func(timeout time.Duration) { pluginTimeout = timeout }(pluginTimeout)
+	pluginTimeout = 100 * time.Millisecond
+
+	plugin, err := StartPlugin(testPlugin(t, "slow", "hang"), "")
+	if err != nil {
+		t.Fatalf("failed to start plugin: %v", err)
+	}
+	_, err = plugin.function("hang")()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "plugin slow did not respond within 100ms")
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	defer delete(registered.funcs, "double")
+	assert.NoError(t, RegisterFunc("double", func(i int) int { return i * 2 }))
+
+	var b bytes.Buffer
+	if assert.NoError(t, (&Tome{}).Template(&b, `{{ double 21 }}`, "test")) {
+		assert.Equal(t, "42", b.String())
+	}
+
+	tests := []struct {
+		name string
+		fn   any
+		err  string
+	}{
+		{name: "double", fn: func() int { return 0 }, err: "function double is already defined"},
+		{name: "trim", fn: func() int { return 0 }, err: "collides with a Sprig function"},
+		{name: "toYaml", fn: func() int { return 0 }, err: "function toYaml is already defined"},
+		{name: "my-func", fn: func() int { return 0 }, err: `invalid function name "my-func"`},
+		{name: "value", fn: 42, err: "int is not a function"},
+		{name: "noResult", fn: func() {}, err: "must return a value"},
+		{name: "badError", fn: func() (int, int) { return 0, 0 }, err: "must return a value"},
+	}
+	for _, tt := range tests {
+		err := RegisterFunc(tt.name, tt.fn)
+		if assert.Error(t, err, tt.name) {
+			assert.Contains(t, err.Error(), tt.err)
+		}
+	}
+}
+
+func TestLoadTomeFileWithPlugins(t *testing.T) {
+	defer ClosePlugins()
+	dir := t.TempDir()
+	config := testPlugin(t, "tome", "shout")
+	command, _ := json.Marshal(config.Command)
+	tomeFile := filepath.Join(dir, ".tome.yaml")
+	os.WriteFile(tomeFile, []byte(fmt.Sprintf("plugins:\n  - name: tome\n    command: %s\n", command)), 0644)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte(`{{ shout .name }}`), 0644)
+
+	base, err := New(dir, t.TempDir(), "", nil, nil, nil, nil, nil, map[string]any{"name": "web"})
+	if err != nil {
+		t.Fatalf("failed to create tome: %v", err)
+	}
+	tomes, err := LoadTomeFile(tomeFile, base)
+	if err != nil {
+		t.Fatalf("failed to load tome file: %v", err)
+	}
+	var b bytes.Buffer
+	if assert.NoError(t, tomes[0].Template(&b, `{{ shout .name }}`, "a.txt")) {
+		assert.Equal(t, "WEB!", b.String())
+	}
+	assert.Empty(t, base.Plugins, "plugins of a tome file are not added to its parent")
+
+	defer func(sandbox bool) { options.Sandbox = sandbox }(options.Sandbox)
+	options.Sandbox = true
+	_, err = LoadTomeFile(tomeFile, base)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "sandbox: cannot start plugin tome")
+	}
+}
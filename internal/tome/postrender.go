@@ -0,0 +1,151 @@
+package tome
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"templar/internal/options"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PostRender is a post-processing step for the outputs of templated files
+// matching Files. Format re-formats the output with a built-in formatter,
+// Validate only checks it, and Command runs a local command (without a
+// shell) on the written file, with "{}" replaced by its path, or the path
+// appended if no argument contains "{}".
+type PostRender struct {
+	Files    []string `yaml:"files" json:"files"`
+	Format   string   `yaml:"format" json:"format,omitempty"`
+	Validate string   `yaml:"validate" json:"validate,omitempty"`
+	Command  []string `yaml:"command" json:"command,omitempty"`
+}
+
+// formatters re-format content in a language, failing if it is invalid.
+var formatters = map[string]func([]byte) ([]byte, error){
+	"yaml":  formatYAML,
+	"json":  formatJSON,
+	"gofmt": format.Source,
+}
+
+// validate checks that the step does exactly one known thing.
+func (p PostRender) validate() error {
+	if len(p.Files) == 0 {
+		return errors.New("post-render step without files")
+	}
+	steps := 0
+	for _, name := range []string{p.Format, p.Validate} {
+		if name == "" {
+			continue
+		}
+		steps++
+		if formatters[name] == nil {
+			return fmt.Errorf("unknown post-render formatter %q, expected yaml, json or gofmt", name)
+		}
+	}
+	if len(p.Command) > 0 {
+		steps++
+	}
+	if steps != 1 {
+		return fmt.Errorf("post-render step for %v must set one of format, validate or command", p.Files)
+	}
+	return nil
+}
+
+// postRender applies the built-in formatters and validators matching
+// inputPath to the rendered output, in the order they are declared. On
+// error, it returns the output as it was before the failing step.
+func (t *Tome) postRender(inputPath, outputPath string, output []byte) ([]byte, error) {
+	for _, step := range t.PostRender {
+		if len(step.Command) > 0 || !t.matchPatterns(step.Files, inputPath) {
+			continue
+		}
+		name := step.Format + step.Validate
+		formatted, err := formatters[name](output)
+		if err != nil {
+			return output, syntaxError(outputPath, name, output, err)
+		}
+		if step.Format != "" {
+			output = formatted
+		}
+	}
+	return output, nil
+}
+
+// runCommands runs the post-render commands matching inputPath on the
+// written output file. A failing command fails the render with its output.
+func (t *Tome) runCommands(inputPath, outputPath string) error {
+	for _, step := range t.PostRender {
+		if len(step.Command) == 0 || !t.matchPatterns(step.Files, inputPath) {
+			continue
+		}
+		if options.Sandbox {
+			return fmt.Errorf("sandbox: cannot run post-render command %q", step.Command)
+		}
+		args := append([]string{}, step.Command...)
+		replaced := false
+		for i, arg := range args {
+			if strings.Contains(arg, "{}") {
+				args[i] = strings.ReplaceAll(arg, "{}", outputPath)
+				replaced = true
+			}
+		}
+		if !replaced {
+			args = append(args, outputPath)
+		}
+		if options.Verbose {
+			logf("[templar] Running %s\n", strings.Join(args, " "))
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = filepath.Dir(outputPath)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("post-render command %q failed for %s: %w\n%s", step.Command, outputPath, err, bytes.TrimSpace(out))
+		}
+	}
+	return nil
+}
+
+// formatYAML re-encodes every document of content with an indent of 2,
+// keeping comments.
+func formatYAML(content []byte) ([]byte, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	documents := 0
+	for {
+		var doc yaml.Node
+		if err := decoder.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if err := encoder.Encode(&doc); err != nil {
+			return nil, err
+		}
+		documents++
+	}
+	if documents == 0 {
+		return content, nil
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// formatJSON indents content with 2 spaces, keeping the order of keys.
+func formatJSON(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(content), "", "  "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
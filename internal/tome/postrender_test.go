@@ -0,0 +1,193 @@
+package tome
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"templar/internal/options"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatters(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter string
+		content   string
+		expected  string
+		err       bool
+	}{
+		{
+			name:      "yaml",
+			formatter: "yaml",
+			content:   "# app\nname:    web\nports:\n    - 80\n---\nkind: Service\n",
+			expected:  "# app\nname: web\nports:\n  - 80\n---\nkind: Service\n",
+		},
+		{
+			name:      "empty yaml",
+			formatter: "yaml",
+			content:   "",
+			expected:  "",
+		},
+		{
+			name:      "invalid yaml",
+			formatter: "yaml",
+			content:   "name: web\n  ports: [80\n",
+			err:       true,
+		},
+		{
+			name:      "json",
+			formatter: "json",
+			content:   "{\"b\": 1, \"a\": [1,2]}\n",
+			expected:  "{\n  \"b\": 1,\n  \"a\": [\n    1,\n    2\n  ]\n}\n",
+		},
+		{
+			name:      "invalid json",
+			formatter: "json",
+			content:   "{\"a\": 1,}",
+			err:       true,
+		},
+		{
+			name:      "gofmt",
+			formatter: "gofmt",
+			content:   "package main\nfunc  main( ) {\n}\n",
+			expected:  "package main\n\nfunc main() {\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatted, err := formatters[tt.formatter]([]byte(tt.content))
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.expected, string(formatted))
+			}
+		})
+	}
+}
+
+func TestPostRenderValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		step PostRender
+		err  string
+	}{
+		{name: "format", step: PostRender{Files: []string{"*.yaml"}, Format: "yaml"}},
+		{name: "validate", step: PostRender{Files: []string{"*.json"}, Validate: "json"}},
+		{name: "command", step: PostRender{Files: []string{"*.sh"}, Command: []string{"shellcheck"}}},
+		{name: "no files", step: PostRender{Format: "yaml"}, err: "without files"},
+		{name: "unknown formatter", step: PostRender{Files: []string{"*"}, Format: "xml"}, err: `unknown post-render formatter "xml"`},
+		{name: "no step", step: PostRender{Files: []string{"*"}}, err: "must set one of"},
+		{name: "two steps", step: PostRender{Files: []string{"*"}, Format: "yaml", Command: []string{"true"}}, err: "must set one of"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.step.validate()
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestRenderWithPostRender(t *testing.T) {
+	in := t.TempDir()
+	out := t.TempDir()
+	files := map[string]string{
+		".tome.yaml": `postRender:
+  - files: ["**/*.yaml"]
+    format: yaml
+  - files: ["**/*.json"]
+    validate: json
+  - files: ["main.go"]
+    format: gofmt
+  - files: ["**/*.txt"]
+    command: [sh, -c, "echo checked >> {}"]
+copy: ["raw.yaml"]
+`,
+		"app.yaml":        "name:    {{ .name }}\n",
+		"raw.yaml":        "name:    raw\n",
+		"data.json":       `{"name":   "{{ .name }}"}`,
+		"main.go":         "package main\nfunc  main( ) {}\n",
+		"sub/.tome.yaml":  "values: {}\n",
+		"sub/nested.yaml": "list:\n    - {{ .name }}\n",
+		"sub/notes.txt":   "{{ .name }}\n",
+	}
+	writeTree(t, in, files)
+
+	base, err := New(in, out, "", nil, nil, nil, nil, nil, map[string]any{"name": "web"})
+	if err != nil {
+		t.Fatalf("failed to create tome: %v", err)
+	}
+	if err := base.Render(in); err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+
+	expected := map[string]string{
+		"app.yaml":        "name: web\n",
+		"raw.yaml":        "name:    raw\n",
+		"data.json":       `{"name":   "web"}`,
+		"main.go":         "package main\n\nfunc main() {}\n",
+		"sub/nested.yaml": "list:\n  - web\n",
+		"sub/notes.txt":   "web\nchecked\n",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(out, name))
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, content, string(data), name)
+		}
+	}
+
+	defer func(force bool) { options.Force = force }(options.Force)
+	options.Force = true
+
+	// Invalid generated files fail the render
+	os.WriteFile(filepath.Join(in, "data.json"), []byte(`{"name": {{ .name }}}`), 0644)
+	err = base.Render(in)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "data.json:1: invalid JSON")
+	}
+	os.WriteFile(filepath.Join(in, "data.json"), []byte(`{}`), 0644)
+
+	// Commands are not run in sandbox mode
+	defer func(sandbox bool) { options.Sandbox = sandbox }(options.Sandbox)
+	options.Sandbox = true
+	err = base.Render(in)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "sandbox: cannot run post-render command")
+	}
+}
+
+func TestRenderFileAppliesPipeline(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "app.yaml.tpl")
+	if err := os.WriteFile(input, []byte("name:    {{ .name }}   \n\n\nports: [80]"), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	tome := &Tome{
+		Source:     dir,
+		Strip:      []string{".tpl"},
+		Values:     map[string]any{"name": "web"},
+		Whitespace: Whitespace{StripTrailingWhitespace: true, CollapseBlankLines: true},
+		PostRender: []PostRender{{Files: []string{"*.tpl"}, Format: "yaml"}},
+	}
+
+	var out strings.Builder
+	assert.NoError(t, tome.RenderFile(&out, input, ""))
+	assert.Equal(t, "name: web\nports: [80]\n", out.String())
+
+	tome.Values["name"] = "[web"
+	tome.PostRender = nil
+	tome.ValidateOutput = true
+	out.Reset()
+	err := tome.RenderFile(&out, input, "")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid output: app.yaml:2: invalid YAML")
+	}
+	assert.Equal(t, "name:    [web\n\nports: [80]", out.String(), "invalid output is still written")
+}
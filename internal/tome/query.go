@@ -0,0 +1,186 @@
+package tome
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"templar/internal/values"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/ohler55/ojg/jp"
+)
+
+// get returns the value at a key path such as "a.b[0].c", using the --set
+// syntax. It looks in the tome's values unless data is given after the
+// default, and returns the default (or nil) if the path does not exist:
+//
+//	get "app.ports[0].name"
+//	get "app.replicas" 1
+//	get "name" "unknown" $service
+//
+// The sprig form get $dict "key" is still supported.
+func (t *Tome) get(path any, args ...any) (any, error) {
+	p, ok := path.(string)
+	if !ok {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("get expects a path, got %T", path)
+		}
+		return sprigGet(path, args[0])
+	}
+
+	var def any
+	var data any = t.Values
+	switch len(args) {
+	case 0:
+	case 1:
+		def = args[0]
+	case 2:
+		def, data = args[0], args[1]
+	default:
+		return nil, fmt.Errorf("get accepts a default and data, got %d extra arguments", len(args))
+	}
+	value, found, err := values.Lookup(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path for get: %w", err)
+	}
+	if !found {
+		return def, nil
+	}
+	return value, nil
+}
+
+// sprigGet implements sprig's get, returning "" for missing keys.
+func sprigGet(dict, key any) (any, error) {
+	d, ok := dict.(map[string]any)
+	k, isString := key.(string)
+	if !ok || !isString {
+		return nil, fmt.Errorf("get expects a dict and a key, got %T and %T", dict, key)
+	}
+	if value, ok := d[k]; ok {
+		return value, nil
+	}
+	return "", nil
+}
+
+// jsonpath returns every value matching a JSONPath expression, in the
+// tome's values or in data if given.
+func (t *Tome) jsonpath(expr string, data ...any) ([]any, error) {
+	target, err := queryTarget(t, "jsonpath", data)
+	if err != nil {
+		return nil, err
+	}
+	x, err := jp.ParseString(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %q: %w", expr, err)
+	}
+	results := x.Get(generic(target))
+	if results == nil {
+		results = []any{}
+	}
+	return results, nil
+}
+
+// jq runs a jq query on the tome's values, or on data if given. A query
+// producing one result returns it, otherwise the results are returned as a list.
+func (t *Tome) jq(query string, data ...any) (any, error) {
+	target, err := queryTarget(t, "jq", data)
+	if err != nil {
+		return nil, err
+	}
+	q, err := gojq.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq query %q: %w", query, err)
+	}
+	code, err := gojq.Compile(q)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq query %q: %w", query, err)
+	}
+
+	results := []any{}
+	iter := code.Run(jqValue(generic(target)))
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			if err, ok := err.(*gojq.HaltError); ok && err.Value() == nil {
+				break
+			}
+			return nil, fmt.Errorf("error running jq query %q: %w", query, err)
+		}
+		results = append(results, v)
+	}
+	if len(results) == 1 {
+		return results[0], nil
+	}
+	return results, nil
+}
+
+func queryTarget(t *Tome, name string, data []any) (any, error) {
+	switch len(data) {
+	case 0:
+		return t.Values, nil
+	case 1:
+		return data[0], nil
+	default:
+		return nil, fmt.Errorf("%s accepts one data argument, got %d", name, len(data))
+	}
+}
+
+// jqValue converts values to the types supported by gojq.
+func jqValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[key] = jqValue(value)
+		}
+		return m
+	case []any:
+		a := make([]any, len(v))
+		for i, value := range v {
+			a[i] = jqValue(value)
+		}
+		return a
+	case nil, bool, string, int, float64:
+		return v
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case uint8:
+		return int(v)
+	case uint16:
+		return int(v)
+	case uint32:
+		return int(v)
+	case uint64:
+		if v > math.MaxInt {
+			return float64(v)
+		}
+		return int(v)
+	case uint:
+		if v > math.MaxInt {
+			return float64(v)
+		}
+		return int(v)
+	case float32:
+		return float64(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,115 @@
+package tome
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func queryTestTome() *Tome {
+	return &Tome{Values: map[string]any{
+		"app": map[string]any{
+			"name": "web",
+			"ports": []any{
+				map[string]any{"name": "http", "port": 80},
+				map[string]any{"name": "https", "port": 443},
+			},
+		},
+	}}
+}
+
+func TestGet(t *testing.T) {
+	tome := queryTestTome()
+
+	value, err := tome.get("app.ports[1].port")
+	assert.NoError(t, err)
+	assert.Equal(t, 443, value)
+
+	value, err = tome.get("app.replicas", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, value)
+
+	value, err = tome.get("app.missing")
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+
+	value, err = tome.get("name", "unknown", map[string]any{"name": "db"})
+	assert.NoError(t, err)
+	assert.Equal(t, "db", value)
+
+	_, err = tome.get("app..name")
+	assert.Error(t, err)
+
+	// sprig's get $dict "key"
+	value, err = tome.get(map[string]any{"a": 1}, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, value)
+	value, err = tome.get(map[string]any{"a": 1}, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "", value)
+}
+
+func TestJsonpath(t *testing.T) {
+	tome := queryTestTome()
+
+	result, err := tome.jsonpath("$.app.ports[*].name")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"http", "https"}, result)
+
+	result, err = tome.jsonpath("$..ports[?(@.port > 100)].name")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"https"}, result)
+
+	result, err = tome.jsonpath("$.missing")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{}, result)
+
+	data, err := mustFromJson(`{"items": [{"id": 1}, {"id": 2}]}`)
+	assert.NoError(t, err)
+	result, err = tome.jsonpath("$.items[-1:].id", data)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{float64(2)}, result)
+
+	_, err = tome.jsonpath("$.[")
+	assert.Error(t, err)
+}
+
+func TestJq(t *testing.T) {
+	tome := queryTestTome()
+
+	result, err := tome.jq(".app.name")
+	assert.NoError(t, err)
+	assert.Equal(t, "web", result)
+
+	result, err = tome.jq(".app.ports[] | select(.port > 100) | .name")
+	assert.NoError(t, err)
+	assert.Equal(t, "https", result)
+
+	result, err = tome.jq(".app.ports[].port")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{80, 443}, result)
+
+	result, err = tome.jq("[.app.ports[].name] | join(\",\")")
+	assert.NoError(t, err)
+	assert.Equal(t, "http,https", result)
+
+	data, err := mustFromYaml("a: {b: 1}")
+	assert.NoError(t, err)
+	result, err = tome.jq(".a | to_entries | map(.key)", data)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"b"}, result)
+
+	_, err = tome.jq(".[")
+	assert.Error(t, err)
+	_, err = tome.jq(`error("boom")`)
+	assert.Error(t, err)
+}
+
+func TestQueryFunctionsInTemplate(t *testing.T) {
+	tome := queryTestTome()
+	var b bytes.Buffer
+	err := tome.Template(&b, `{{ get "app.ports[0].port" }} {{ jq ".app.name" }} {{ jsonpath "$.app.ports[1].name" | first }} {{ get "app.x" "none" }}`, "test.tmpl")
+	assert.NoError(t, err)
+	assert.Equal(t, "80 web https none", b.String())
+}
@@ -0,0 +1,112 @@
+package tome
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"templar/internal/options"
+	"templar/internal/secrets"
+)
+
+// resolvePath resolves a path used by a template function against the
+// directory of the current template. With --sandbox, the path must stay
+// inside the tome's roots after following symlinks.
+func (rd *RenderDir) resolvePath(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("empty path")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rd.Dir, path)
+	}
+	path = filepath.Clean(path)
+	if !options.Sandbox {
+		return path, nil
+	}
+
+	roots := rd.Tome.Roots
+	if len(roots) == 0 {
+		roots = []string{rd.Tome.Source}
+	}
+
+	resolved, err := evalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("sandbox: cannot resolve %s: %w", path, err)
+	}
+	for _, root := range roots {
+		resolvedRoot, err := evalSymlinks(root)
+		if err != nil {
+			return "", fmt.Errorf("sandbox: cannot resolve root %s: %w", root, err)
+		}
+		if within(resolvedRoot, resolved) {
+			return path, nil
+		}
+	}
+	if resolved != path {
+		return "", fmt.Errorf("sandbox: %s resolves to %s, outside of the allowed roots %s", path, resolved, strings.Join(roots, ", "))
+	}
+	return "", fmt.Errorf("sandbox: %s is outside of the allowed roots %s", path, strings.Join(roots, ", "))
+}
+
+// evalSymlinks returns the absolute path with all symlinks resolved. Missing
+// trailing components are kept as-is, so paths that do not exist yet can
+// still be checked.
+func evalSymlinks(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+	resolvedParent, err := evalSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolvedParent, filepath.Base(path)), nil
+}
+
+// within reports whether path is root or inside it.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// secretsConfig checks the secret providers declared in a tome file against
+// the sandbox: file providers must read from the tome's roots, and exec
+// providers are refused. It returns the configuration with the paths of file
+// providers resolved against dir.
+func (t *Tome) secretsConfig(config secrets.Config, dir, file string) (secrets.Config, error) {
+	providers := make(map[string]secrets.ProviderConfig, len(config.Providers))
+	for name, provider := range config.Providers {
+		switch provider.Type {
+		case "exec":
+			if options.Sandbox {
+				return config, fmt.Errorf("sandbox: cannot run secret provider %s declared in %s", name, file)
+			}
+		case "file":
+			if provider.Path != "" {
+				path, err := (&RenderDir{Dir: dir, Tome: t}).resolvePath(provider.Path)
+				if err != nil {
+					return config, fmt.Errorf("secret provider %s: %w", name, err)
+				}
+				provider.Path = path
+			}
+		}
+		providers[name] = provider
+	}
+	config.Providers = providers
+	return config, nil
+}
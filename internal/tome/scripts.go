@@ -0,0 +1,291 @@
+package tome
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"templar/internal/options"
+	"templar/internal/values"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// maxScriptSteps bounds the computation of one script execution or call.
+const maxScriptSteps = 100_000_000
+
+// Script is a Starlark script whose global functions are template functions.
+type Script struct {
+	Path      string
+	Functions []string
+	globals   starlark.StringDict
+}
+
+// scriptFileOptions are the Starlark dialect options of scripts.
+var scriptFileOptions = &syntax.FileOptions{Set: true, While: true, TopLevelControl: true, GlobalReassign: true}
+
+// newThread returns a Starlark thread for path. Scripts can only load other
+// scripts and read files with --script-read, through read_file.
+func (t *Tome) newThread(path string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name:  path,
+		Print: func(_ *starlark.Thread, msg string) { logf("[templar] %s: %s\n", filepath.Base(path), msg) },
+	}
+	thread.SetMaxExecutionSteps(maxScriptSteps)
+	if options.ScriptRead {
+		thread.Load = func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+			modulePath, err := t.scriptPath(filepath.Dir(path), module)
+			if err != nil {
+				return nil, err
+			}
+			return t.execScript(modulePath, nil)
+		}
+	}
+	return thread
+}
+
+// predeclared returns the builtins available to the scripts of the tome.
+func (t *Tome) predeclared(dir string) starlark.StringDict {
+	predeclared := starlark.StringDict{}
+	if options.ScriptRead {
+		predeclared["read_file"] = starlark.NewBuiltin("read_file", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var path string
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &path); err != nil {
+				return nil, err
+			}
+			content, err := (&RenderDir{Dir: dir, Tome: t}).readFile(path)
+			if err != nil {
+				return nil, err
+			}
+			return starlark.String(content), nil
+		})
+	}
+	return predeclared
+}
+
+// scriptPath resolves the path of a script relative to dir, within the
+// sandbox roots with --sandbox.
+func (t *Tome) scriptPath(dir, path string) (string, error) {
+	return (&RenderDir{Dir: dir, Tome: t}).resolvePath(path)
+}
+
+// execScript runs the script at path with extra predeclared values and
+// returns its globals.
+func (t *Tome) execScript(path string, extra starlark.StringDict) (starlark.StringDict, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading script: %w", err)
+	}
+	predeclared := t.predeclared(filepath.Dir(path))
+	for name, value := range extra {
+		predeclared[name] = value
+	}
+	globals, err := starlark.ExecFileOptions(scriptFileOptions, t.newThread(path), path, src, predeclared)
+	if err != nil {
+		return nil, scriptError(err)
+	}
+	return globals, nil
+}
+
+// LoadScript runs the Starlark script at path, relative to dir, and returns
+// it with its global functions, except the ones starting with "_".
+func (t *Tome) LoadScript(dir, path string) (*Script, error) {
+	path, err := t.scriptPath(dir, path)
+	if err != nil {
+		return nil, err
+	}
+	globals, err := t.execScript(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	script := &Script{Path: path, globals: globals}
+	for _, name := range globals.Keys() {
+		if _, ok := globals[name].(starlark.Callable); ok && !strings.HasPrefix(name, "_") {
+			script.Functions = append(script.Functions, name)
+		}
+	}
+	return script, nil
+}
+
+// AddScripts makes the functions of scripts available to the tome's
+// templates, failing if one collides with an existing function.
+func (t *Tome) AddScripts(scripts ...*Script) error {
+	for _, s := range scripts {
+		funcs := t.funcMap("")
+		for _, name := range s.Functions {
+			if err := checkFuncName(name, funcs); err != nil {
+				return fmt.Errorf("script %s: %w", s.Path, err)
+			}
+		}
+		t.Scripts = append(t.Scripts, s)
+	}
+	t.partials = nil
+	return nil
+}
+
+// function returns the template function calling the script function name.
+func (s *Script) function(t *Tome, name string) func(args ...any) (any, error) {
+	return func(args ...any) (any, error) {
+		starArgs := make(starlark.Tuple, len(args))
+		for i, arg := range args {
+			starArgs[i] = toStarlark(arg)
+		}
+		result, err := starlark.Call(t.newThread(s.Path), s.globals[name], starArgs, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, scriptError(err))
+		}
+		return fromStarlark(result)
+	}
+}
+
+// RunScriptHook runs the Starlark script at path, relative to dir, with the
+// tome's values as the mutable dict "values", and uses the changed values
+// for rendering. The internal "__tome__" key is not passed to the script.
+func (t *Tome) RunScriptHook(dir, path string) error {
+	path, err := t.scriptPath(dir, path)
+	if err != nil {
+		return err
+	}
+	vals := make(map[string]any, len(t.Values))
+	for key, value := range t.Values {
+		if key != "__tome__" {
+			vals[key] = value
+		}
+	}
+	var dict starlark.Value = toStarlark(vals)
+	globals, err := t.execScript(path, starlark.StringDict{"values": dict})
+	if err != nil {
+		return err
+	}
+	// The script may also assign a new dict to values
+	if reassigned, ok := globals["values"]; ok {
+		dict = reassigned
+	}
+	result, err := fromStarlark(dict)
+	if err != nil {
+		return fmt.Errorf("invalid values from script %s: %w", path, err)
+	}
+	derived, ok := result.(map[string]any)
+	if !ok {
+		return fmt.Errorf("invalid values from script %s: expected a dict, got %s", path, dict.Type())
+	}
+	derived["__tome__"] = t.Values["__tome__"]
+	values.MarkSensitiveKeys(derived)
+	t.Values = derived
+	return nil
+}
+
+// scriptError adds the Starlark backtrace to evaluation errors.
+func scriptError(err error) error {
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return fmt.Errorf("%s", evalErr.Backtrace())
+	}
+	return err
+}
+
+// toStarlark converts a template value to a Starlark value.
+func toStarlark(v any) starlark.Value {
+	switch v := jqValue(generic(v)).(type) {
+	case nil:
+		return starlark.None
+	case bool:
+		return starlark.Bool(v)
+	case string:
+		return starlark.String(v)
+	case int:
+		return starlark.MakeInt(v)
+	case float64:
+		return starlark.Float(v)
+	case []any:
+		elems := make([]starlark.Value, len(v))
+		for i, elem := range v {
+			elems[i] = toStarlark(elem)
+		}
+		return starlark.NewList(elems)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		dict := starlark.NewDict(len(v))
+		for _, key := range keys {
+			dict.SetKey(starlark.String(key), toStarlark(v[key]))
+		}
+		return dict
+	default:
+		return starlark.String(fmt.Sprint(v))
+	}
+}
+
+// fromStarlark converts a Starlark value to a template value.
+func fromStarlark(v starlark.Value) (any, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return int(i), nil
+		}
+		f, _ := new(big.Float).SetInt(v.BigInt()).Float64()
+		return f, nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.Bytes:
+		return string(v), nil
+	case *starlark.List:
+		return fromStarlarkList(v)
+	case starlark.Tuple:
+		return fromStarlarkList(v)
+	case *starlark.Set:
+		return fromStarlark(starlark.NewList(setElems(v)))
+	case *starlark.Dict:
+		m := make(map[string]any, v.Len())
+		for _, item := range v.Items() {
+			key, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("dict key %s is not a string", item[0])
+			}
+			value, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			m[string(key)] = value
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("cannot use %s value %s in templates", v.Type(), v)
+	}
+}
+
+// fromStarlarkList converts the elements of a Starlark list or tuple.
+func fromStarlarkList(v starlark.Indexable) ([]any, error) {
+	list := make([]any, v.Len())
+	for i := range list {
+		elem, err := fromStarlark(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		list[i] = elem
+	}
+	return list, nil
+}
+
+// setElems returns the elements of a Starlark set.
+func setElems(s *starlark.Set) []starlark.Value {
+	elems := make([]starlark.Value, 0, s.Len())
+	iter := s.Iterate()
+	defer iter.Done()
+	var elem starlark.Value
+	for iter.Next(&elem) {
+		elems = append(elems, elem)
+	}
+	return elems
+}
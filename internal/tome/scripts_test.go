@@ -0,0 +1,205 @@
+package tome
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"templar/internal/options"
+	"templar/internal/values"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScriptFunctions(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "helpers.star"), []byte(`
+def slug(s):
+    return "-".join([w for w in s.lower().split(" ") if w])
+
+def replicas(env, sizes):
+    return sizes.get(env, 1) * 2
+
+def ports(services):
+    return sorted([s["port"] for s in services])
+
+def raw(s):
+    return bytes("raw:" + s)
+
+def pair(s):
+    return (s, b"x")
+
+def _private():
+    return "hidden"
+
+def raise_error(msg):
+    fail(msg)
+
+def forever():
+    n = 0
+    while True:
+        n += 1
+
+LIMIT = 3
+`), 0644)
+
+	tome := &Tome{Source: dir, Values: map[string]any{
+		"title":    "Hello  Big World",
+		"sizes":    map[string]any{"prod": 3},
+		"services": []any{map[string]any{"port": 443}, map[string]any{"port": 80}},
+	}}
+	script, err := tome.LoadScript(dir, "helpers.star")
+	if err != nil {
+		t.Fatalf("failed to load script: %v", err)
+	}
+	assert.Equal(t, []string{"forever", "pair", "ports", "raise_error", "raw", "replicas", "slug"}, script.Functions)
+	if err := tome.AddScripts(script); err != nil {
+		t.Fatalf("failed to add script: %v", err)
+	}
+
+	tests := []struct {
+		text     string
+		expected string
+		err      string
+	}{
+		{text: `{{ slug .title }}`, expected: "hello-big-world"},
+		{text: `{{ replicas "prod" .sizes }} {{ replicas "dev" .sizes }}`, expected: "6 2"},
+		{text: `{{ ports .services | toJson }}`, expected: "[80,443]"},
+		{text: `{{ raw "a" }}`, expected: "raw:a"},
+		{text: `{{ pair "a" | toJson }}`, expected: `["a","x"]`},
+		{text: `{{ raise_error "boom" }}`, err: "boom"},
+		{text: `{{ forever }}`, err: "too many steps"},
+		{text: `{{ _private }}`, err: `function "_private" not defined`},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		err := tome.Template(&b, tt.text, "test")
+		if tt.err != "" {
+			if assert.Error(t, err, tt.text) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+			continue
+		}
+		if assert.NoError(t, err, tt.text) {
+			assert.Equal(t, tt.expected, b.String(), tt.text)
+		}
+	}
+
+	// Script functions must not collide with other functions
+	os.WriteFile(filepath.Join(dir, "collide.star"), []byte("def upper(s):\n    return s\n"), 0644)
+	collide, err := tome.LoadScript(dir, "collide.star")
+	if assert.NoError(t, err) {
+		err = tome.AddScripts(collide)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "function upper collides with a Sprig function")
+		}
+	}
+	err = tome.AddScripts(script)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "function forever is already defined")
+	}
+}
+
+func TestScriptFileAccess(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"lib.star": "def double(x):\n    return x * 2\n",
+		"data.txt": "42",
+		"uses_load.star": `load("lib.star", "double")
+def quadruple(x):
+    return double(double(x))
+`,
+		"uses_read.star": "DATA = read_file(\"data.txt\")\n",
+	})
+
+	tome := &Tome{Source: dir}
+	_, err := tome.LoadScript(dir, "uses_load.star")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "load not implemented")
+	}
+	_, err = tome.LoadScript(dir, "uses_read.star")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "undefined: read_file")
+	}
+
+	defer func(scriptRead bool) { options.ScriptRead = scriptRead }(options.ScriptRead)
+	options.ScriptRead = true
+	script, err := tome.LoadScript(dir, "uses_load.star")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"quadruple"}, script.Functions, "loaded functions are not exported")
+	}
+	_, err = tome.LoadScript(dir, "uses_read.star")
+	assert.NoError(t, err)
+
+	// With --sandbox, file access stays within the tome's roots
+	defer func(sandbox bool) { options.Sandbox = sandbox }(options.Sandbox)
+	options.Sandbox = true
+	os.WriteFile(filepath.Join(dir, "escape.star"), []byte("DATA = read_file(\"../../etc/passwd\")\n"), 0644)
+	_, err = tome.LoadScript(dir, "escape.star")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "sandbox:")
+	}
+}
+
+func TestLoadTomeFileWithScripts(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".tome.yaml":   "scripts: [helpers.star]\nscript: derive.star\nvalues:\n  env: prod\n",
+		"helpers.star": "def shout(s):\n    return s.upper() + \"!\"\n",
+		"derive.star": `values["replicas"] = 3 if values["env"] == "prod" else 1
+values["hosts"] = ["%s-%d.%s" % (values["name"], i, values["env"]) for i in range(2)]
+values["db_password"] = "s3cret"
+values["token"] = b"abc"
+`,
+		"sub/.tome.yaml": "script: reset.star\n",
+		"sub/reset.star": "values = {\"name\": values[\"name\"].upper()}\n",
+	}
+	writeTree(t, dir, files)
+
+	base, err := New(dir, t.TempDir(), "", nil, nil, nil, nil, nil, map[string]any{"name": "web"})
+	if err != nil {
+		t.Fatalf("failed to create tome: %v", err)
+	}
+	tomes, err := LoadTomeFile(filepath.Join(dir, ".tome.yaml"), base)
+	if err != nil {
+		t.Fatalf("failed to load tome file: %v", err)
+	}
+	tome := tomes[0]
+	assert.Equal(t, 3, tome.Values["replicas"])
+	assert.Equal(t, []any{"web-0.prod", "web-1.prod"}, tome.Values["hosts"])
+	assert.Equal(t, "abc", tome.Values["token"])
+	assert.NotNil(t, tome.Values["__tome__"])
+	assert.Equal(t, values.Redacted, values.Redact(tome.Values["db_password"]))
+
+	var b bytes.Buffer
+	if assert.NoError(t, tome.Template(&b, `{{ shout .name }} x{{ .replicas }}`, "test")) {
+		assert.Equal(t, "WEB! x3", b.String())
+	}
+
+	subTomes, err := LoadTomeFile(filepath.Join(dir, "sub", ".tome.yaml"), tome)
+	if err != nil {
+		t.Fatalf("failed to load sub tome file: %v", err)
+	}
+	assert.Equal(t, "WEB", subTomes[0].Values["name"])
+	assert.Nil(t, subTomes[0].Values["replicas"])
+	assert.Len(t, subTomes[0].Scripts, 1, "sub-tomes inherit script functions")
+}
+
+func TestLoadTomeFileValidatesScriptValues(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".tome.yaml":         "schema: values.schema.json\nscript: derive.star\n",
+		"values.schema.json": `{"type": "object", "properties": {"replicas": {"type": "integer", "default": 2}}}`,
+		"derive.star":        "values[\"replicas\"] = \"many\"\n",
+	}
+	writeTree(t, dir, files)
+
+	base, err := New(dir, t.TempDir(), "", nil, nil, nil, nil, nil, map[string]any{})
+	if err != nil {
+		t.Fatalf("failed to create tome: %v", err)
+	}
+	_, err = LoadTomeFile(filepath.Join(dir, ".tome.yaml"), base)
+	if assert.Error(t, err, "values set by the script hook are validated") {
+		assert.Contains(t, err.Error(), "/replicas")
+	}
+}
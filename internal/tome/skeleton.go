@@ -0,0 +1,261 @@
+package tome
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"gopkg.in/yaml.v3"
+)
+
+// listElement marks a path segment addressing the elements of a list
+// that is ranged over, e.g. {{ range .items }}{{ .name }}{{ end }}.
+const listElement = "[]"
+
+// skeletonKey is a node in the tree of value keys referenced by templates.
+type skeletonKey struct {
+	children   map[string]*skeletonKey
+	files      map[string]bool
+	defaultVal any
+	hasDefault bool
+}
+
+func newSkeletonKey() *skeletonKey {
+	return &skeletonKey{children: map[string]*skeletonKey{}, files: map[string]bool{}}
+}
+
+// ValuesSkeleton scans the templates, template paths and tome files below dir
+// and returns a commented YAML document with every referenced value key,
+// the files that use it and any default found in a `default` pipeline.
+// Files are selected like Render selects them with the given patterns and
+// delimiters: excluded files are skipped, and only the paths of copied files
+// are scanned.
+func ValuesSkeleton(dir string, strip, include, exclude, copy, temp, delims []string) (string, error) {
+	base, err := New(dir, "", "", strip, include, exclude, copy, temp, map[string]any{})
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateDelims(delims); err != nil {
+		return "", err
+	}
+	base.Delims = delims
+
+	s := &skeletonScan{root: newSkeletonKey(), dir: dir}
+	if err := s.scan(base, dir); err != nil {
+		return "", err
+	}
+
+	content := &yaml.Node{Kind: yaml.MappingNode}
+	if len(s.root.children) > 0 {
+		content = skeletonNode(s.root)
+	}
+	doc := &yaml.Node{
+		Kind:        yaml.DocumentNode,
+		HeadComment: fmt.Sprintf("Values referenced by the templates in %s", dir),
+		Content:     []*yaml.Node{content},
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return "", fmt.Errorf("error encoding values skeleton: %w", err)
+	}
+	encoder.Close()
+	return buf.String(), nil
+}
+
+type skeletonScan struct {
+	root *skeletonKey
+	dir  string
+}
+
+// scan records the value keys referenced by path and, for directories, the
+// files below it, following the same rules as Render.
+func (s *skeletonScan) scan(t *Tome, path string) error {
+	if filepath.Base(path) == ".tome.yaml" || !t.ShouldInclude(path) {
+		return nil
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	relPath, err := filepath.Rel(s.dir, path)
+	if err != nil {
+		return err
+	}
+	if relPath != "." {
+		if err := s.scanTemplate(t, relPath, relPath); err != nil {
+			return err
+		}
+	}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return fmt.Errorf("failed to read directory: %w", err)
+		}
+		tomes := []*Tome{t}
+		tomesFile := filepath.Join(path, ".tome.yaml")
+		if content, err := os.ReadFile(tomesFile); err == nil {
+			relTomesFile, _ := filepath.Rel(s.dir, tomesFile)
+			if err := s.scanTemplate(t, string(content), relTomesFile); err != nil {
+				return err
+			}
+			tomes = s.subTomes(t, path, string(content))
+		}
+		for _, tome := range tomes {
+			for _, entry := range entries {
+				if err := s.scan(tome, filepath.Join(path, entry.Name())); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("error reading symlink %q: %w", path, err)
+		}
+		return s.scanTemplate(t, target, relPath)
+	}
+	if t.shouldCopy(path) {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return s.scanTemplate(t, string(content), relPath)
+}
+
+// subTomes returns the tomes configured by the tome file in dir, rendered
+// without values, so their include, exclude, copy and temp patterns and
+// delimiters apply to the files below dir. Tome files that cannot be
+// rendered without values keep the patterns of the parent tome, with a
+// warning, since excluded files may then be scanned.
+func (s *skeletonScan) subTomes(parent *Tome, dir, content string) []*Tome {
+	var rendered bytes.Buffer
+	tmpl, err := parent.parse(template.New(".tome.yaml").Funcs(parent.funcMap(dir)), content)
+	if err == nil {
+		err = tmpl.Execute(&rendered, map[string]any{})
+	}
+	var configs []Config
+	if err == nil {
+		configs, err = parseTomeConfigs(rendered.Bytes())
+	}
+	tomes := make([]*Tome, 0, len(configs))
+	for _, config := range configs {
+		if err != nil {
+			break
+		}
+		config.inheritPatterns(parent)
+		var tome *Tome
+		tome, err = New(dir, "", "", config.Strip, config.Include, config.Exclude, config.Copy, config.Temp, map[string]any{})
+		if err == nil {
+			tome.Delims = parent.Delims
+			if len(config.Delims) > 0 {
+				err = ValidateDelims(config.Delims)
+				tome.Delims = config.Delims
+			}
+		}
+		tomes = append(tomes, tome)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[templar] ⚠️  %s cannot be rendered without values, using the patterns of the parent directory: %v\n",
+			filepath.Join(dir, ".tome.yaml"), err)
+		return []*Tome{parent}
+	}
+	return tomes
+}
+
+// scanTemplate parses text as a template with the delimiters of t and
+// records every value key it references. Functions are not checked, since
+// plugins and scripts are not loaded.
+func (s *skeletonScan) scanTemplate(t *Tome, text, file string) error {
+	trees, err := t.parseTrees(file, text)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", file, err)
+	}
+	w := &templateWalker{
+		ref: func(path []string, _ parse.Node, _ bool) { s.record(path, file) },
+		def: func(path []string, value any) { s.record(path, file).setDefault(value) },
+	}
+	for _, tree := range trees {
+		w.walk(tree.Root, []string{}, false)
+	}
+	return nil
+}
+
+func (s *skeletonScan) record(path []string, file string) *skeletonKey {
+	if len(path) == 0 || path[0] == "__tome__" {
+		return newSkeletonKey()
+	}
+	key := s.root
+	for _, segment := range path {
+		child, ok := key.children[segment]
+		if !ok {
+			child = newSkeletonKey()
+			key.children[segment] = child
+		}
+		key = child
+	}
+	key.files[file] = true
+	return key
+}
+
+func (k *skeletonKey) setDefault(def any) {
+	if !k.hasDefault {
+		k.defaultVal = def
+		k.hasDefault = true
+	}
+}
+
+// skeletonNode converts a key tree into a YAML node, commenting each key
+// with the files that reference it.
+func skeletonNode(key *skeletonKey) *yaml.Node {
+	if len(key.children) == 0 {
+		node := &yaml.Node{}
+		if key.hasDefault {
+			if err := node.Encode(key.defaultVal); err == nil {
+				return node
+			}
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	}
+
+	if elem, ok := key.children[listElement]; ok && len(key.children) == 1 {
+		return &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{skeletonNode(elem)}}
+	}
+
+	names := make([]string, 0, len(key.children))
+	for name := range key.children {
+		if name != listElement {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+	for _, name := range names {
+		child := key.children[name]
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Value: name}
+		if len(child.files) > 0 {
+			files := make([]string, 0, len(child.files))
+			for file := range child.files {
+				files = append(files, file)
+			}
+			sort.Strings(files)
+			keyNode.HeadComment = "Used in: " + strings.Join(files, ", ")
+		}
+		mapping.Content = append(mapping.Content, keyNode, skeletonNode(child))
+	}
+	return mapping
+}
@@ -0,0 +1,127 @@
+package tome
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValuesSkeleton(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		".tome.yaml":              "target: {{ .output.dir | default \"out\" }}\n",
+		"app.yaml":                "name: {{ .app.name }}\nreplicas: {{ default 2 .app.replicas }}\n{{ with .app.image }}image: {{ .repository }}:{{ .tag }}{{ end }}\n",
+		"ports.txt":               "{{ range .ports }}{{ .name }}={{ .port }}\n{{ end }}{{ $.app.name }} {{ .__tome__.source }}",
+		"sub/{{ .app.name }}.txt": "{{ if .debug }}debug{{ end }}",
+	}
+	writeTree(t, tempDir, files)
+
+	result, err := ValuesSkeleton(tempDir, nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `# Values referenced by the templates in ` + tempDir + `
+
+app:
+  # Used in: app.yaml
+  image:
+    # Used in: app.yaml
+    repository: null
+    # Used in: app.yaml
+    tag: null
+  # Used in: app.yaml, ports.txt, sub/{{ .app.name }}.txt
+  name: null
+  # Used in: app.yaml
+  replicas: 2
+# Used in: sub/{{ .app.name }}.txt
+debug: null
+output:
+  # Used in: .tome.yaml
+  dir: out
+# Used in: ports.txt
+ports:
+  - # Used in: ports.txt
+    name: null
+    # Used in: ports.txt
+    port: null
+`
+	assert.Equal(t, expected, result)
+}
+
+func TestValuesSkeleton_InvalidTemplate(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "bad.txt"), []byte("{{ .unclosed"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	_, err := ValuesSkeleton(tempDir, nil, nil, nil, nil, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestValuesSkeleton_UnrenderableTomeFile(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"app/.tome.yaml": "exclude: ['[[ required \"env\" .env ]].txt']\n",
+		"app/prod.txt":   "[[ .prod ]]",
+	}
+	writeTree(t, tempDir, files)
+
+	stderr := os.Stderr
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	os.Stderr = w
+	result, err := ValuesSkeleton(tempDir, nil, nil, nil, nil, nil, []string{"[[", "]]"})
+	os.Stderr = stderr
+	w.Close()
+	warning, _ := io.ReadAll(r)
+
+	if assert.NoError(t, err) {
+		assert.Contains(t, result, "prod: null", "the parent patterns apply")
+	}
+	assert.Contains(t, string(warning), filepath.Join(tempDir, "app", ".tome.yaml")+" cannot be rendered without values")
+}
+
+func TestValuesSkeleton_PluginFunctions(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("{{ shout .name }}"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	result, err := ValuesSkeleton(tempDir, nil, nil, nil, nil, nil, nil)
+	if assert.NoError(t, err, "functions of plugins and scripts are not loaded") {
+		assert.Contains(t, result, "# Used in: a.txt\nname: null\n")
+	}
+}
+
+func TestValuesSkeleton_FollowsTomeFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"app.yaml":                 "name: {{ .name }}\n",
+		"_helpers.tpl":             `{{ define "labels" }}team: {{ .team }}{{ end }}`,
+		"chart/.tome.yaml":         "copy:\n  - templates/**\ndelims: ['[[', ']]']\n",
+		"chart/values.yaml":        "image: [[ .image ]]\nhelm: {{ .Values.image }}\n",
+		"chart/templates/app.yaml": "{{ .Values.name }}",
+		"chart/templates/logo.png": "\x89PNG{{",
+	}
+	writeTree(t, tempDir, files)
+
+	result, err := ValuesSkeleton(tempDir, nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `# Values referenced by the templates in ` + tempDir + `
+
+# Used in: chart/values.yaml
+image: null
+# Used in: app.yaml
+name: null
+# Used in: _helpers.tpl
+team: null
+`
+	assert.Equal(t, expected, result)
+}
@@ -12,24 +12,50 @@ import (
 )
 
 func (t *Tome) Template(writer io.Writer, text string, name string) error {
-	tmpl, err := template.New(name).Funcs(t.funcMap(filepath.Dir(name))).Parse(text)
+	return t.templateData(writer, text, name, filepath.Dir(name), t.Values)
+}
+
+// templateData renders text with the tome's functions and the given data.
+// Relative paths in file functions are resolved against dir. Missing keys
+// are only reported when data is a values map.
+func (t *Tome) templateData(writer io.Writer, text, name, dir string, data any) error {
+	_, isValues := data.(map[string]any)
+	return t.renderTemplate(writer, text, name, dir, data, isValues)
+}
+
+// renderTemplate is templateData, reporting missing keys only if checkKeys
+// is set and data is a values map.
+func (t *Tome) renderTemplate(writer io.Writer, text, name, dir string, data any, checkKeys bool) error {
+	var tmpl *template.Template
+	if len(t.Partials) > 0 {
+		set, err := t.partialTemplates()
+		if err != nil {
+			return err
+		}
+		tmpl = set.New(name)
+	} else {
+		tmpl = template.New(name)
+	}
+	tmpl, err := t.parse(tmpl.Funcs(t.funcMap(dir)), text)
 	if err != nil {
 		return err
 	}
 
-	missingTemplateKeys, err := findMissingTemplateKeys(tmpl, text, t.Values)
-	if err != nil {
-		return fmt.Errorf("error finding missing template keys for %s: %w", name, err)
-	}
-	if len(missingTemplateKeys) > 0 {
-		for _, missingKey := range missingTemplateKeys {
-			fmt.Printf("[templar] ⚠️  %s:%d:%d missing key '%s'\n", name, missingKey.Line, missingKey.Column, missingKey.Name)
+	if vals, ok := data.(map[string]any); ok && checkKeys {
+		missingTemplateKeys, err := findMissingTemplateKeys(tmpl, text, vals)
+		if err != nil {
+			return fmt.Errorf("error finding missing template keys for %s: %w", name, err)
 		}
-		if options.Strict {
-			return errors.New("missing template keys not allowed in strict mode")
+		if len(missingTemplateKeys) > 0 {
+			for _, missingKey := range missingTemplateKeys {
+				fmt.Printf("[templar] ⚠️  %s:%d:%d missing key '%s'\n", name, missingKey.Line, missingKey.Column, missingKey.Name)
+			}
+			if options.Strict {
+				return errors.New("missing template keys not allowed in strict mode")
+			}
 		}
 	}
-	return tmpl.Execute(writer, t.Values)
+	return tmpl.Execute(writer, data)
 }
 
 // MissingKey holds the name and position of a missing template key
@@ -41,47 +67,161 @@ type MissingKey struct {
 
 // FindMissingTemplateKeysWithPos parses the template and returns all keys
 // that are missing in the given values map, along with their line and column.
+// Only fields outside of if, with and range blocks are checked.
 func findMissingTemplateKeys(tmpl *template.Template, tmplStr string, values map[string]interface{}) ([]MissingKey, error) {
 	var missing []MissingKey
 
 	// Split the template into lines for positional tracking
 	lines := strings.Split(tmplStr, "\n")
 
-	// Traverse the template AST
-	var walk func(node parse.Node)
-	walk = func(node parse.Node) {
-		switch n := node.(type) {
-		case *parse.ListNode:
-			for _, sub := range n.Nodes {
-				walk(sub)
-			}
-		case *parse.ActionNode:
-			walk(n.Pipe)
-		case *parse.PipeNode:
-			for _, cmd := range n.Cmds {
-				walk(cmd)
-			}
-		case *parse.CommandNode:
-			for _, arg := range n.Args {
-				walk(arg)
-			}
-		case *parse.FieldNode:
-			// .Field format, check the first part only (top-level)
-			if len(n.Ident) > 0 {
-				key := n.Ident[0]
-				if _, ok := values[key]; !ok {
-					line, col := positionFromOffset(n.Pos, lines)
-					missing = append(missing, MissingKey{Name: key, Line: line, Column: col})
+	w := &templateWalker{ref: func(path []string, node parse.Node, nested bool) {
+		// .Field format, check the first part only (top-level)
+		if _, ok := node.(*parse.FieldNode); !ok || nested {
+			return
+		}
+		key := path[0]
+		if _, ok := values[key]; !ok {
+			line, col := positionFromOffset(node.Position(), lines)
+			missing = append(missing, MissingKey{Name: key, Line: line, Column: col})
+		}
+	}}
+	// Not processing nested templates for now
+	w.walk(tmpl.Tree.Root, []string{}, false)
+
+	return missing, nil
+}
+
+// templateWalker traverses a template AST and reports every value it
+// references with its key path from the root values. Paths below a range
+// contain listElement for the elements of the list.
+type templateWalker struct {
+	// ref is called for every field, $ variable or dot that refers to a
+	// value. nested is true inside if, with and range blocks.
+	ref func(path []string, node parse.Node, nested bool)
+	// def, if set, is called for literal defaults of `default X .key` and
+	// `.key | default X`.
+	def func(path []string, value any)
+}
+
+// walk traverses node with dot set to the key path "." refers to, or nil
+// when it is unknown (e.g. inside a range over a variable).
+func (w *templateWalker) walk(node parse.Node, dot []string, nested bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, sub := range n.Nodes {
+			w.walk(sub, dot, nested)
+		}
+	case *parse.ActionNode:
+		w.walkPipe(n.Pipe, dot, nested)
+	case *parse.IfNode:
+		w.walkPipe(n.Pipe, dot, true)
+		w.walk(n.List, dot, true)
+		w.walk(n.ElseList, dot, true)
+	case *parse.WithNode:
+		w.walkPipe(n.Pipe, dot, true)
+		w.walk(n.List, pipePath(n.Pipe, dot), true)
+		w.walk(n.ElseList, dot, true)
+	case *parse.RangeNode:
+		w.walkPipe(n.Pipe, dot, true)
+		elem := pipePath(n.Pipe, dot)
+		if elem != nil {
+			elem = append(elem, listElement)
+		}
+		w.walk(n.List, elem, true)
+		w.walk(n.ElseList, dot, true)
+	case *parse.TemplateNode:
+		w.walkPipe(n.Pipe, dot, true)
+	}
+}
+
+func (w *templateWalker) walkPipe(pipe *parse.PipeNode, dot []string, nested bool) {
+	if pipe == nil {
+		return
+	}
+	for i, cmd := range pipe.Cmds {
+		// Detect `default X .key` and `.key | default X`
+		if w.def != nil && len(cmd.Args) > 1 {
+			if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "default" {
+				if def, ok := literalValue(cmd.Args[1]); ok {
+					var target parse.Node
+					if len(cmd.Args) == 3 {
+						target = cmd.Args[2]
+					} else if len(cmd.Args) == 2 && i > 0 && len(pipe.Cmds[i-1].Args) == 1 {
+						target = pipe.Cmds[i-1].Args[0]
+					}
+					if path := argPath(target, dot); path != nil {
+						w.def(path, def)
+					}
 				}
 			}
-		case *parse.TemplateNode:
-			// Not processing nested templates for now
+		}
+		for _, arg := range cmd.Args {
+			w.walkArg(arg, dot, nested)
 		}
 	}
+}
 
-	walk(tmpl.Tree.Root)
+func (w *templateWalker) walkArg(arg parse.Node, dot []string, nested bool) {
+	switch n := arg.(type) {
+	case *parse.PipeNode:
+		w.walkPipe(n, dot, nested)
+	case *parse.ChainNode:
+		w.walkArg(n.Node, dot, nested)
+	default:
+		if path := argPath(arg, dot); len(path) > 0 {
+			w.ref(path, arg, nested)
+		}
+	}
+}
 
-	return missing, nil
+// argPath returns the key path referenced by a field, dot or root variable node.
+func argPath(arg parse.Node, dot []string) []string {
+	switch n := arg.(type) {
+	case *parse.FieldNode:
+		if dot == nil {
+			return nil
+		}
+		return append(append([]string{}, dot...), n.Ident...)
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			return append([]string{}, n.Ident[1:]...)
+		}
+	case *parse.DotNode:
+		if len(dot) > 0 {
+			return append([]string{}, dot...)
+		}
+	}
+	return nil
+}
+
+// pipePath returns the key path a with/range pipeline evaluates to, if it is
+// a single field reference.
+func pipePath(pipe *parse.PipeNode, dot []string) []string {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return nil
+	}
+	return argPath(pipe.Cmds[0].Args[0], dot)
+}
+
+// literalValue returns the Go value of a string, number or bool literal node.
+func literalValue(node parse.Node) (any, bool) {
+	switch n := node.(type) {
+	case *parse.StringNode:
+		return n.Text, true
+	case *parse.BoolNode:
+		return n.True, true
+	case *parse.NumberNode:
+		if n.IsInt {
+			return n.Int64, true
+		}
+		if n.IsFloat {
+			return n.Float64, true
+		}
+	}
+	return nil, false
 }
 
 // positionFromOffset returns the line and column number based on Pos
@@ -2,30 +2,61 @@ package tome
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"text/template"
+
+	"templar/internal/secrets"
+	"templar/internal/values"
 
 	"github.com/bmatcuk/doublestar/v4"
 )
 
 type Tome struct {
-	Source  string         `json:"source"`
-	Target  string         `json:"target"`
-	Mode    os.FileMode    `json:"mode"`
-	Strip   []string       `json:"strip"`
-	Include []string       `json:"include"`
-	Exclude []string       `json:"exclude"`
-	Copy    []string       `json:"copy"`
-	Temp    []string       `json:"temp"`
-	Values  map[string]any `json:"values"`
+	Source   string            `json:"source"`
+	Target   string            `json:"target"`
+	Mode     os.FileMode       `json:"mode"`
+	Strip    []string          `json:"strip"`
+	Include  []string          `json:"include"`
+	Exclude  []string          `json:"exclude"`
+	Copy     []string          `json:"copy"`
+	Temp     []string          `json:"temp"`
+	Values   map[string]any    `json:"values"`
+	Schema   *values.Schema    `json:"-"`
+	Secrets  *secrets.Resolver `json:"-"`
+	Roots    []string          `json:"-"`
+	Plugins  []*Plugin         `json:"-"`
+	Scripts  []*Script         `json:"-"`
+	Partials []string          `json:"partials"`
+	Delims   []string          `json:"delims"`
+	partials *template.Template
+
+	Whitespace
+	PostRender     []PostRender   `json:"postRender"`
+	ValidateOutput bool           `json:"validateOutput"`
+	OutputSchemas  []OutputSchema `json:"-"`
+
+	rawValues map[string]any
+	tplDepth  int
+	output    string
 }
 
 func (t *Tome) String() string {
 	return fmt.Sprintf("{source: %s, target: %s, mode: %o, strip: %s, include: %v, exclude: %v, copy: %v, temp: %v, values: %v}",
-		t.Source, t.Target, t.Mode, t.Strip, t.Include, t.Exclude, t.Copy, t.Temp, t.Values)
+		t.Source, t.Target, t.Mode, t.Strip, t.Include, t.Exclude, t.Copy, t.Temp, values.Redact(t.Values))
+}
+
+// MarshalJSON encodes the tome with sensitive values redacted, so verbose
+// tome dumps never contain secrets.
+func (t *Tome) MarshalJSON() ([]byte, error) {
+	type tome Tome
+	redacted := tome(*t)
+	redacted.Values, _ = values.Redact(t.Values).(map[string]any)
+	return json.Marshal(&redacted)
 }
 
 func New(source, target, mode string, strip, include, exclude, copy, temp []string, values map[string]any) (*Tome, error) {
@@ -1,9 +1,14 @@
 package tome
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"templar/internal/values"
 )
 
 func TestShouldInclude(t *testing.T) {
@@ -123,3 +128,38 @@ func TestShouldCopy(t *testing.T) {
 		})
 	}
 }
+
+func TestMarshalJSONRedactsSensitiveValues(t *testing.T) {
+	values.MarkSensitive("tome-secret-value")
+	tome := &Tome{
+		Source: "templates",
+		Values: map[string]any{
+			"password": "tome-secret-value",
+			"name":     "web",
+		},
+	}
+
+	b, err := json.Marshal(tome)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.NotContains(t, string(b), "tome-secret-value")
+	assert.Contains(t, string(b), `"password":"[REDACTED]"`)
+	assert.Contains(t, string(b), `"name":"web"`)
+	assert.Equal(t, "tome-secret-value", tome.Values["password"], "tome values must not be modified")
+	assert.NotContains(t, tome.String(), "tome-secret-value")
+}
+
+// writeTree writes files, by path relative to dir, creating their directories.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
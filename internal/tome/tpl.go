@@ -0,0 +1,154 @@
+package tome
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"templar/internal/values"
+)
+
+// maxTplDepth bounds nested tpl calls, which only recurse that deep on cycles
+const maxTplDepth = 100
+
+// tpl renders text as a template with the tome's values, or with data if given.
+func (rd *RenderDir) tpl(text string, data ...any) (string, error) {
+	if len(data) > 1 {
+		return "", fmt.Errorf("tpl accepts one data argument, got %d", len(data))
+	}
+	var ctx any = rd.Tome.Values
+	if len(data) == 1 {
+		ctx = data[0]
+	}
+	if rd.Tome.tplDepth >= maxTplDepth {
+		return "", fmt.Errorf("tpl nested more than %d levels deep, values may reference each other in a cycle", maxTplDepth)
+	}
+	rd.Tome.tplDepth++
+	defer func() { rd.Tome.tplDepth-- }()
+
+	var b strings.Builder
+	if err := rd.Tome.templateData(&b, text, "tpl", rd.Dir, ctx); err != nil {
+		return "", fmt.Errorf("error rendering tpl: %w", err)
+	}
+	return b.String(), nil
+}
+
+// valueTemplate is a string in the values that contains a template.
+type valueTemplate struct {
+	path  []string
+	text  string
+	value string
+	set   func(string)
+}
+
+func (v *valueTemplate) String() string {
+	return strings.Join(v.path, ".")
+}
+
+// RenderValues renders the strings in the tome's values that contain
+// templates, using the values themselves as data, until no value changes.
+// Every pass renders the original templates, so a value referencing another
+// value gets its rendered form, whichever way it is referenced, while output
+// that merely looks like a template, e.g. an escaped Helm expression, is
+// kept as-is. Values still changing after one pass more than there are
+// templates, or settling on the unrendered template of another value,
+// reference each other in a cycle. Rendered values are strings,
+// unless the tome's schema declares an integer, number or boolean for them.
+// The unrendered values are kept, so sub-tomes can override the values
+// referenced by them.
+func (t *Tome) RenderValues() error {
+	raw := t.Values
+	if t.rawValues != nil {
+		raw = t.rawValues
+	}
+	rendered, _ := values.DeepCopy(raw).(map[string]any)
+	dir := t.Source
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	t.rawValues, t.Values = raw, rendered
+
+	templates := t.collectValueTemplates(rendered)
+	// Without cycles, every pass resolves at least one more level of
+	// references, so the values settle within len(templates)+1 passes
+	for pass := 1; ; pass++ {
+		var changed []string
+		for _, vt := range templates {
+			var b strings.Builder
+			if err := t.renderTemplate(&b, vt.text, "values:"+vt.String(), dir, rendered, pass == 1); err != nil {
+				return fmt.Errorf("error rendering value %s: %w", vt, err)
+			}
+			if b.String() != vt.value {
+				vt.value = b.String()
+				vt.set(vt.value)
+				changed = append(changed, vt.String())
+			}
+		}
+		if len(changed) == 0 {
+			break
+		}
+		if pass > len(templates) {
+			return fmt.Errorf("values still change after %d passes, they reference each other in a cycle: %s",
+				pass, strings.Join(changed, ", "))
+		}
+	}
+	// A cycle can also settle, e.g. a: '{{ .b }}' and b: '{{ .a }}' both end
+	// up as '{{ .a }}', copying a template that was never rendered
+	sources := make(map[string]bool, len(templates))
+	for _, vt := range templates {
+		sources[vt.text] = true
+	}
+	var cyclic []string
+	for _, vt := range templates {
+		if sources[vt.value] {
+			cyclic = append(cyclic, vt.String())
+		}
+	}
+	if len(cyclic) > 0 {
+		return fmt.Errorf("values reference each other in a cycle: %s", strings.Join(cyclic, ", "))
+	}
+
+	if t.Schema != nil {
+		paths := make([][]string, len(templates))
+		for i, vt := range templates {
+			paths[i] = vt.path
+		}
+		t.Schema.ConvertStrings(rendered, paths)
+	}
+	return nil
+}
+
+// collectValueTemplates finds the strings containing templates in vals,
+// sorted by path. The internal "__tome__" key is skipped.
+func (t *Tome) collectValueTemplates(vals map[string]any) []*valueTemplate {
+	left, _ := t.delims()
+	var templates []*valueTemplate
+	var walk func(v any, path []string, set func(string))
+	walk = func(v any, path []string, set func(string)) {
+		switch v := v.(type) {
+		case map[string]any:
+			for key := range v {
+				if len(path) == 0 && key == "__tome__" {
+					continue
+				}
+				m, key := v, key
+				walk(v[key], append(append([]string{}, path...), key), func(s string) { m[key] = s })
+			}
+		case []any:
+			for i := range v {
+				a, i := v, i
+				walk(v[i], append(append([]string{}, path...), strconv.Itoa(i)), func(s string) { a[i] = s })
+			}
+		case string:
+			if strings.Contains(v, left) {
+				templates = append(templates, &valueTemplate{path: path, text: v, value: v, set: set})
+			}
+		}
+	}
+	walk(vals, nil, nil)
+	sort.Slice(templates, func(i, j int) bool { return templates[i].String() < templates[j].String() })
+	return templates
+}
@@ -0,0 +1,233 @@
+package tome
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"templar/internal/options"
+	"templar/internal/values"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTpl(t *testing.T) {
+	rd := RenderDir{Dir: t.TempDir(), Tome: &Tome{Values: map[string]any{
+		"host": "example.com",
+		"url":  "https://{{ .host }}",
+		"sub":  map[string]any{"name": "web"},
+	}}}
+
+	result, err := rd.tpl(rd.Tome.Values["url"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", result)
+
+	result, err = rd.tpl("{{ .name | upper }}", rd.Tome.Values["sub"])
+	assert.NoError(t, err)
+	assert.Equal(t, "WEB", result)
+
+	_, err = rd.tpl("{{ .a", nil)
+	assert.Error(t, err)
+
+	// A value rendering itself through tpl must not recurse forever
+	rd.Tome.Values["loop"] = `{{ tpl .loop . }}`
+	_, err = rd.tpl(rd.Tome.Values["loop"].(string))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "nested more than")
+	}
+}
+
+func TestRenderValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]any
+		expected map[string]any
+		err      string
+	}{
+		{
+			name: "references are rendered first",
+			values: map[string]any{
+				"a":    "{{ .b }}-a",
+				"b":    "{{ .c.d }}-b",
+				"c":    map[string]any{"d": "d", "list": []any{"{{ $.a }}"}},
+				"port": 80,
+			},
+			expected: map[string]any{
+				"a":    "d-b-a",
+				"b":    "d-b",
+				"c":    map[string]any{"d": "d", "list": []any{"d-b-a"}},
+				"port": 80,
+			},
+		},
+		{
+			name:     "escaped templates are rendered once",
+			values:   map[string]any{"helm": `{{ "{{ .Release.Name }}" }}-{{ .name }}`, "name": "web", "ref": "{{ .helm }}"},
+			expected: map[string]any{"helm": "{{ .Release.Name }}-web", "name": "web", "ref": "{{ .Release.Name }}-web"},
+		},
+		{
+			name: "references in with and range blocks are rendered first",
+			values: map[string]any{
+				"a":  "{{ with .db }}{{ .host }}{{ end }}/{{ range .hosts }}{{ .name }}{{ end }}",
+				"db": map[string]any{"host": "{{ .base }}"},
+				"hosts": []any{
+					map[string]any{"name": "{{ .base }}-0"},
+				},
+				"base": "x",
+			},
+			expected: map[string]any{
+				"a":     "x/x-0",
+				"db":    map[string]any{"host": "x"},
+				"hosts": []any{map[string]any{"name": "x-0"}},
+				"base":  "x",
+			},
+		},
+		{
+			name:     "references through index, get and pipelines are rendered",
+			values:   map[string]any{"a": `{{ index . "b" }}`, "b": `{{ get "c" }}`, "c": `{{ "d" | index $ }}`, "d": "x"},
+			expected: map[string]any{"a": "x", "b": "x", "c": "x", "d": "x"},
+		},
+		{
+			name:   "cycle",
+			values: map[string]any{"a": "{{ .b }}", "b": "{{ .c }}", "c": "{{ .a }}"},
+			err:    "values still change after 4 passes, they reference each other in a cycle: a, b, c",
+		},
+		{
+			name:   "self reference",
+			values: map[string]any{"a": map[string]any{"b": "{{ .a }}"}},
+			err:    "cycle: a.b",
+		},
+		{
+			name:   "cycle through index",
+			values: map[string]any{"a": `{{ index . "b" }}`, "b": `{{ get "a" }}`},
+			err:    "values reference each other in a cycle: a, b",
+		},
+		{
+			name:   "growing cycle",
+			values: map[string]any{"a": `{{ index . "b" }}-a`, "b": `{{ get "a" }}`},
+			err:    "values still change after 3 passes, they reference each other in a cycle: a, b",
+		},
+		{
+			name:   "invalid template",
+			values: map[string]any{"a": "{{ .b"},
+			err:    "error rendering value a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tome := &Tome{Source: t.TempDir(), Values: tt.values}
+			err := tome.RenderValues()
+			if tt.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.err)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, tome.Values)
+		})
+	}
+}
+
+func TestLoadWithRenderValues(t *testing.T) {
+	defer func(render bool) { options.RenderValues = render }(options.RenderValues)
+	options.RenderValues = true
+
+	tempDir := t.TempDir()
+	tomeFile := filepath.Join(tempDir, ".tome.yaml")
+	if err := os.WriteFile(tomeFile, []byte("values:\n  host: override.example.com\n"), 0644); err != nil {
+		t.Fatalf("failed to write tome file: %v", err)
+	}
+
+	base := &Tome{Source: filepath.Dir(tempDir), Target: "/tmp", Values: map[string]any{
+		"host": "example.com",
+		"url":  "https://{{ .host }}",
+	}}
+	if err := base.RenderValues(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, "https://example.com", base.Values["url"])
+
+	// Sub-tomes render the parent's templates with their own values
+	tomes, err := LoadTomeFile(tomeFile, base)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, "https://override.example.com", tomes[0].Values["url"])
+}
+
+func TestRenderValuesWithSchema(t *testing.T) {
+	tempDir := t.TempDir()
+	schemaFile := filepath.Join(tempDir, "values.schema.json")
+	if err := os.WriteFile(schemaFile, []byte(`{
+  "type": "object",
+  "properties": {
+    "port": {"type": "integer"},
+    "ratio": {"type": "number"},
+    "debug": {"type": "boolean"},
+    "name": {"type": ["string", "integer"]},
+    "ports": {"type": "array", "items": {"type": "integer"}}
+  }
+}`), 0644); err != nil {
+		t.Fatalf("failed to write schema file: %v", err)
+	}
+	schema, err := values.LoadSchema(schemaFile)
+	if err != nil {
+		t.Fatalf("failed to load schema: %v", err)
+	}
+
+	tome := &Tome{Source: tempDir, Schema: schema, Values: map[string]any{
+		"base":  8080,
+		"port":  "{{ .base }}",
+		"ratio": "{{ 0.5 }}",
+		"debug": "{{ true }}",
+		"name":  "{{ .base }}",
+		"ports": []any{"{{ .base }}", 443},
+	}}
+	if err := tome.RenderValues(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, 8080, tome.Values["port"])
+	assert.Equal(t, 0.5, tome.Values["ratio"])
+	assert.Equal(t, true, tome.Values["debug"])
+	assert.Equal(t, "8080", tome.Values["name"], "strings allowed by the schema are kept")
+	assert.Equal(t, []any{8080, 443}, tome.Values["ports"])
+	assert.NoError(t, schema.Validate(tome.Values))
+
+	tome = &Tome{Source: tempDir, Schema: schema, Values: map[string]any{"port": "{{ \"http\" }}"}}
+	if err := tome.RenderValues(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Error(t, schema.Validate(tome.Values))
+}
+
+func TestLoadValidatesRenderedValues(t *testing.T) {
+	defer func(render bool) { options.RenderValues = render }(options.RenderValues)
+	options.RenderValues = true
+
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "values.schema.json"),
+		[]byte(`{"type": "object", "properties": {"port": {"type": "integer", "minimum": 1024}}}`), 0644); err != nil {
+		t.Fatalf("failed to write schema file: %v", err)
+	}
+	tomeFile := filepath.Join(tempDir, ".tome.yaml")
+	base := &Tome{Source: filepath.Dir(tempDir), Target: "/tmp", Values: map[string]any{"port": "{{ .base }}"}}
+
+	for _, tt := range []struct {
+		base any
+		err  bool
+	}{{8080, false}, {80, true}} {
+		if err := os.WriteFile(tomeFile, []byte(fmt.Sprintf("schema: values.schema.json\nvalues:\n  base: %v\n", tt.base)), 0644); err != nil {
+			t.Fatalf("failed to write tome file: %v", err)
+		}
+		tomes, err := LoadTomeFile(tomeFile, base)
+		if tt.err {
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "/port")
+			}
+			continue
+		}
+		if assert.NoError(t, err) {
+			assert.Equal(t, tt.base, tomes[0].Values["port"])
+		}
+	}
+}
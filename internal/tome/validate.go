@@ -0,0 +1,222 @@
+package tome
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/scanner"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"templar/internal/values"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// OutputSchema validates the outputs of templated files matching Files
+// against a JSON Schema.
+type OutputSchema struct {
+	Files  []string
+	Schema *values.Schema
+}
+
+// formatNames are the names of the formats used in errors.
+var formatNames = map[string]string{"yaml": "YAML", "json": "JSON", "toml": "TOML", "gofmt": "Go"}
+
+// yamlLinePattern matches the line number yaml.v3 puts in its errors.
+var yamlLinePattern = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// trailingDataError reports data after the top-level value of a JSON output.
+type trailingDataError struct {
+	offset int64
+}
+
+func (e *trailingDataError) Error() string {
+	return "unexpected data after the top-level value"
+}
+
+// outputFormat returns the format validated for an output path by its extension.
+func outputFormat(outputPath string) string {
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".json":
+		return "json"
+	case ".toml":
+		return "toml"
+	}
+	return ""
+}
+
+// validateOutput parses the output of a templated file by the extension of
+// outputPath if ValidateOutput is set or an output schema matches inputPath,
+// and validates it against the matching output schemas. Errors report lines
+// of the output.
+func (t *Tome) validateOutput(inputPath, outputPath string, output []byte) error {
+	var schemas []*values.Schema
+	for _, s := range t.OutputSchemas {
+		if t.matchPatterns(s.Files, inputPath) {
+			schemas = append(schemas, s.Schema)
+		}
+	}
+	if !t.ValidateOutput && len(schemas) == 0 {
+		return nil
+	}
+	format := outputFormat(outputPath)
+	if format == "" {
+		if len(schemas) > 0 {
+			return fmt.Errorf("%s: cannot validate against schema %s, expected a .yaml, .json or .toml file", outputPath, schemas[0].Path)
+		}
+		return nil
+	}
+
+	documents, nodes, err := parseOutput(format, output)
+	if err != nil {
+		return syntaxError(outputPath, format, output, err)
+	}
+	for _, schema := range schemas {
+		var lines []string
+		for i, doc := range documents {
+			err := schema.Validate(doc)
+			var schemaErr *values.SchemaError
+			if errors.As(err, &schemaErr) {
+				for _, v := range schemaErr.Violations {
+					location := outputPath
+					if i < len(nodes) {
+						if line := pointerLine(nodes[i], v.Path); line > 0 {
+							location = fmt.Sprintf("%s:%d", outputPath, line)
+						}
+					}
+					lines = append(lines, fmt.Sprintf("  %s: %s: %s", location, v.Path, v.Message))
+				}
+			} else if err != nil {
+				return err
+			}
+		}
+		if len(lines) > 0 {
+			return fmt.Errorf("%s does not match schema %s:\n%s", outputPath, schema.Path, strings.Join(lines, "\n"))
+		}
+	}
+	return nil
+}
+
+// parseOutput decodes the documents of an output in the given format. For
+// YAML and JSON, it also returns the node tree of each document to find lines.
+func parseOutput(format string, output []byte) ([]any, []*yaml.Node, error) {
+	switch format {
+	case "yaml":
+		var documents []any
+		var nodes []*yaml.Node
+		decoder := yaml.NewDecoder(bytes.NewReader(output))
+		for {
+			var node yaml.Node
+			if err := decoder.Decode(&node); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, nil, err
+			}
+			var doc any
+			if err := node.Decode(&doc); err != nil {
+				return nil, nil, err
+			}
+			documents = append(documents, doc)
+			nodes = append(nodes, &node)
+		}
+		return documents, nodes, nil
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(output))
+		decoder.UseNumber()
+		var doc any
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, nil, err
+		}
+		if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+			return nil, nil, &trailingDataError{offset: decoder.InputOffset()}
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal(output, &node); err != nil {
+			return []any{doc}, nil, nil
+		}
+		return []any{doc}, []*yaml.Node{&node}, nil
+	case "toml":
+		var doc map[string]any
+		if err := toml.Unmarshal(output, &doc); err != nil {
+			return nil, nil, err
+		}
+		return []any{doc}, nil, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported format %s", format)
+}
+
+// syntaxError reports a parse error of an output in the given format at its
+// line in the output, when known.
+func syntaxError(outputPath, format string, output []byte, err error) error {
+	line, message := 0, err.Error()
+	var jsonErr *json.SyntaxError
+	var trailingErr *trailingDataError
+	var tomlErr toml.ParseError
+	var goErr scanner.ErrorList
+	lineAt := func(offset int64) int {
+		return bytes.Count(output[:min(int(offset), len(output))], []byte("\n")) + 1
+	}
+	switch {
+	case errors.As(err, &jsonErr):
+		line = lineAt(jsonErr.Offset)
+	case errors.As(err, &trailingErr):
+		line = lineAt(trailingErr.offset)
+	case errors.As(err, &tomlErr):
+		line, message = tomlErr.Position.Line, tomlErr.Message
+	case errors.As(err, &goErr) && len(goErr) > 0:
+		line, message = goErr[0].Pos.Line, goErr[0].Msg
+	default:
+		if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			message = match[2]
+		}
+	}
+	name := formatNames[format]
+	if line > 0 {
+		return fmt.Errorf("%s:%d: invalid %s: %s", outputPath, line, name, message)
+	}
+	return fmt.Errorf("%s: invalid %s: %s", outputPath, name, message)
+}
+
+// pointerLine returns the line of the value at a JSON pointer in a YAML
+// node tree, or of its closest existing parent, or 0 if unknown.
+func pointerLine(node *yaml.Node, pointer string) int {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == token {
+					next = node.Content[i+1]
+					line = node.Content[i].Line
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line
+}
@@ -0,0 +1,116 @@
+package tome
+
+import (
+	"os"
+	"path/filepath"
+	"templar/internal/options"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		content string
+		err     string
+	}{
+		{name: "valid yaml", output: "a.yaml", content: "a: 1\n---\nb: [1, 2]\n"},
+		{name: "valid json", output: "a.json", content: "{\"a\": [1, 2]}\n"},
+		{name: "valid toml", output: "a.toml", content: "[a]\nb = 1\n"},
+		{name: "other extensions are not parsed", output: "a.txt", content: "a: [\n"},
+		{
+			name:    "invalid yaml",
+			output:  "a.yml",
+			content: "a: 1\nb:\n  - 2\n c: 3\n",
+			err:     "a.yml:3: invalid YAML: did not find expected key",
+		},
+		{
+			name:    "invalid yaml in second document",
+			output:  "a.yaml",
+			content: "a: 1\n---\nb: [1,\n",
+			err:     "a.yaml:3: invalid YAML:",
+		},
+		{
+			name:    "invalid json",
+			output:  "a.json",
+			content: "{\n  \"a\": 1,\n  \"b\": 2,\n}\n",
+			err:     "a.json:4: invalid JSON: invalid character '}'",
+		},
+		{
+			name:    "json with trailing data",
+			output:  "a.json",
+			content: "{}\n{}\n",
+			err:     "a.json:2: invalid JSON: unexpected data after the top-level value",
+		},
+		{
+			name:    "invalid toml",
+			output:  "a.toml",
+			content: "a = 1\nb = \n",
+			err:     "a.toml:2: invalid TOML:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tome := &Tome{Source: "/in", ValidateOutput: true}
+			err := tome.validateOutput("/in/"+tt.output, tt.output, []byte(tt.content))
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestPointerLine(t *testing.T) {
+	_, nodes, err := parseOutput("yaml", []byte("a: 1\nb:\n  c:\n    - x\n    - y\n"))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	assert.Equal(t, 1, pointerLine(nodes[0], "/"))
+	assert.Equal(t, 1, pointerLine(nodes[0], "/a"))
+	assert.Equal(t, 5, pointerLine(nodes[0], "/b/c/1"))
+	assert.Equal(t, 3, pointerLine(nodes[0], "/b/c/7"))
+}
+
+func TestRenderWithOutputSchemas(t *testing.T) {
+	in := t.TempDir()
+	out := t.TempDir()
+	files := map[string]string{
+		".tome.yaml":             "outputSchemas:\n  \"deploy/*.yaml\": deployment.schema.yaml\n",
+		"deployment.schema.yaml": "type: object\nrequired: [name]\nproperties:\n  replicas:\n    type: integer\n",
+		"deploy/web.yaml":        "name: web\nreplicas: {{ .replicas }}\n---\nname: worker\nreplicas: 1\n",
+		"broken.yaml":            "a: [\n",
+	}
+	writeTree(t, in, files)
+	defer func(force bool) { options.Force = force }(options.Force)
+	options.Force = true
+
+	// Only files with an output schema are parsed unless ValidateOutput is set
+	base, err := New(in, out, "", nil, nil, nil, nil, nil, map[string]any{"replicas": 2})
+	if err != nil {
+		t.Fatalf("failed to create tome: %v", err)
+	}
+	assert.NoError(t, base.Render(in))
+
+	base.ValidateOutput = true
+	err = base.Render(in)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "broken.yaml:1: invalid YAML")
+	}
+	os.Remove(filepath.Join(in, "broken.yaml"))
+
+	base.Values["replicas"] = "two"
+	err = base.Render(in)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "web.yaml does not match schema")
+		assert.Contains(t, err.Error(), "web.yaml:2: /replicas:")
+	}
+	// The invalid output is kept to inspect it
+	data, err := os.ReadFile(filepath.Join(out, "deploy", "web.yaml"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "replicas: two")
+	}
+}
@@ -2,13 +2,16 @@ package tome
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"templar/internal/options"
+	"templar/internal/values"
 )
 
 // Render traverses the file system starting from the specified root path.
@@ -32,7 +35,7 @@ func (t *Tome) Render(inputPath string) error {
 	}
 	if !t.ShouldInclude(inputPath) {
 		if options.Verbose {
-			fmt.Println("[templar] Skipping:", filepath.Base(inputPath))
+			logf("[templar] Skipping: %s\n", filepath.Base(inputPath))
 		}
 		return nil
 	}
@@ -40,6 +43,12 @@ func (t *Tome) Render(inputPath string) error {
 	if err != nil {
 		return fmt.Errorf("failed to stat %s: %w", inputPath, err)
 	}
+	if !info.IsDir() && t.isPartial(inputPath) {
+		if options.Verbose {
+			logf("[templar] Skipping partial: %s\n", filepath.Base(inputPath))
+		}
+		return nil
+	}
 
 	outputPath, err := t.formatPath(inputPath)
 	if err != nil {
@@ -63,7 +72,7 @@ func (t *Tome) Render(inputPath string) error {
 		if _, err := os.Stat(tomesFile); errors.Is(err, os.ErrNotExist) {
 			// No tome file, render dir entries using the current tome
 			if options.Verbose {
-				fmt.Printf("[templar] Creating directory %v %s\n", mode, outputPath)
+				logf("[templar] Creating directory %v %s\n", mode, outputPath)
 			}
 			if !options.DryRun {
 				err = os.MkdirAll(outputPath, mode)
@@ -86,10 +95,10 @@ func (t *Tome) Render(inputPath string) error {
 			for _, subTome := range subTomes {
 				if options.Verbose {
 					b, _ := json.MarshalIndent(subTome, "", "  ")
-					fmt.Printf("[templar] Tome %s\n", string(b))
+					logf("[templar] Tome %s\n", string(b))
 				}
 				if options.Verbose {
-					fmt.Printf("[templar] Creating directory %v %s\n", subTome.Mode, subTome.Target)
+					logf("[templar] Creating directory %v %s\n", subTome.Mode, subTome.Target)
 				}
 				if !options.DryRun {
 					err = os.MkdirAll(subTome.Target, mode)
@@ -116,11 +125,11 @@ func (t *Tome) Render(inputPath string) error {
 
 	if options.Verbose {
 		if symlink {
-			fmt.Printf("[templar] Recreating symlink %s -> %s\n", inputPath, outputPath)
+			logf("[templar] Recreating symlink %s -> %s\n", inputPath, outputPath)
 		} else if copy {
-			fmt.Printf("[templar] Copying %s -> %v %s\n", inputPath, mode, outputPath)
+			logf("[templar] Copying %s -> %v %s\n", inputPath, mode, outputPath)
 		} else {
-			fmt.Printf("[templar] Templating %s -> %v %s\n", inputPath, mode, outputPath)
+			logf("[templar] Templating %s -> %v %s\n", inputPath, mode, outputPath)
 		}
 	}
 
@@ -153,7 +162,7 @@ func (t *Tome) Render(inputPath string) error {
 		// Remove existing symlink if it exists and force option is set
 		if _, err := os.Lstat(outputPath); err == nil && options.Force {
 			if options.Verbose {
-				fmt.Printf("[templar] Removing existing symlink %s\n", outputPath)
+				logf("[templar] Removing existing symlink %s\n", outputPath)
 			}
 			if err := os.Remove(outputPath); err != nil {
 				return fmt.Errorf("failed to remove existing symlink: %w", err)
@@ -183,12 +192,21 @@ func (t *Tome) Render(inputPath string) error {
 		if err != nil {
 			return fmt.Errorf("error creating output file: %w", err)
 		}
-		err = t.Template(outFile, string(content), inputPath)
+		t.output = outputPath
+		output, err := t.renderContent(content, inputPath, outputPath)
+		t.output = ""
+		if _, writeErr := outFile.Write(output); err == nil {
+			err = writeErr
+		}
 		outFile.Close()
 		os.Rename(outputPath+".tmp", outputPath)
 		if err != nil {
 			return fmt.Errorf("error templating contents: %w", err)
 		}
+		// Invalid output is kept, so the reported lines can be inspected
+		if err := t.validateOutput(inputPath, outputPath, output); err != nil {
+			return fmt.Errorf("invalid output: %w", err)
+		}
 	}
 
 	// Set the file permissions
@@ -196,9 +214,53 @@ func (t *Tome) Render(inputPath string) error {
 		return fmt.Errorf("error setting file permissions: %w", err)
 	}
 
+	if !copy {
+		return t.runCommands(inputPath, outputPath)
+	}
+
 	return nil
 }
 
+// RenderFile templates the file at inputPath to writer, with the same
+// whitespace options, post-render formatters and output validation as Render.
+// outputPath names the output in errors and selects the format to validate;
+// if empty, the file name of inputPath is used, without stripped suffixes.
+func (t *Tome) RenderFile(writer io.Writer, inputPath, outputPath string) error {
+	content, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("error reading input file: %w", err)
+	}
+	if outputPath == "" {
+		outputPath, err = t.templatePath(filepath.Base(inputPath))
+		if err != nil {
+			return fmt.Errorf("error formatting path: %w", err)
+		}
+	}
+	output, err := t.renderContent(content, inputPath, outputPath)
+	if _, writeErr := writer.Write(output); err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error templating contents: %w", err)
+	}
+	if err := t.validateOutput(inputPath, outputPath, output); err != nil {
+		return fmt.Errorf("invalid output: %w", err)
+	}
+	return nil
+}
+
+// renderContent templates content and applies the whitespace options and
+// post-render formatters. On error, it returns the output rendered so far.
+func (t *Tome) renderContent(content []byte, inputPath, outputPath string) ([]byte, error) {
+	var rendered bytes.Buffer
+	err := t.Template(&rendered, string(content), inputPath)
+	output := t.Whitespace.Apply(rendered.Bytes())
+	if err == nil {
+		output, err = t.postRender(inputPath, outputPath, output)
+	}
+	return output, err
+}
+
 func confirmOverwrite(path string) bool {
 	fmt.Printf("[templar] ⚠️  '%s' already exists. Overwrite? [y/N]: ", path)
 	reader := bufio.NewReader(os.Stdin)
@@ -206,3 +268,8 @@ func confirmOverwrite(path string) bool {
 	answer = strings.ToLower(strings.TrimSpace(answer))
 	return answer == "y" || answer == "yes"
 }
+
+// logf prints a log message with all sensitive values redacted.
+func logf(format string, args ...any) {
+	fmt.Print(values.RedactString(fmt.Sprintf(format, args...)))
+}
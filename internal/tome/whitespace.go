@@ -0,0 +1,167 @@
+package tome
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Whitespace holds the options of a tome controlling whitespace and line
+// endings of templated files.
+type Whitespace struct {
+	TrimBlocks              bool   `json:"trimBlocks"`
+	StripTrailingWhitespace bool   `json:"stripTrailingWhitespace"`
+	CollapseBlankLines      bool   `json:"collapseBlankLines"`
+	EnsureTrailingNewline   bool   `json:"ensureTrailingNewline"`
+	LineEndings             string `json:"lineEndings"`
+}
+
+// blockKeywords are the actions whose lines are removed with trimBlocks.
+var blockKeywords = map[string]bool{
+	"if": true, "else": true, "end": true, "range": true, "with": true,
+	"define": true, "block": true, "break": true, "continue": true,
+}
+
+// validate checks the line endings option.
+func (w Whitespace) validate() error {
+	switch w.LineEndings {
+	case "", "lf", "crlf":
+		return nil
+	}
+	return fmt.Errorf("invalid lineEndings %q, expected lf or crlf", w.LineEndings)
+}
+
+// Apply post-processes rendered output according to the options. Without
+// lineEndings, every line keeps its own line ending.
+func (w Whitespace) Apply(content []byte) []byte {
+	if !w.StripTrailingWhitespace && !w.CollapseBlankLines && !w.EnsureTrailingNewline && w.LineEndings == "" {
+		return content
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	var b strings.Builder
+	blank := false
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		text := strings.TrimSuffix(line, "\n")
+		newline := line[len(text):]
+		if strings.HasSuffix(text, "\r") && newline != "" {
+			text, newline = text[:len(text)-1], "\r\n"
+		}
+		if w.StripTrailingWhitespace {
+			text = strings.TrimRight(text, " \t")
+		}
+		if w.CollapseBlankLines {
+			if strings.TrimSpace(text) == "" && newline != "" {
+				if blank {
+					continue
+				}
+				blank = true
+			} else {
+				blank = false
+			}
+		}
+		if newline == "" && w.EnsureTrailingNewline {
+			newline = "\n"
+			if strings.Contains(b.String(), "\r\n") {
+				newline = "\r\n"
+			}
+		}
+		if newline != "" {
+			switch w.LineEndings {
+			case "lf":
+				newline = "\n"
+			case "crlf":
+				newline = "\r\n"
+			}
+		}
+		b.WriteString(text)
+		b.WriteString(newline)
+	}
+	return []byte(b.String())
+}
+
+// trimBlocks removes the lines of text holding nothing but a block action
+// (if, else, end, range, with, define, block, break, continue) or a comment
+// from the templates parsed from it, so they leave no blank lines behind.
+func trimBlocks(tmpl *template.Template, text, left, right string) {
+	lines := standaloneTags(text, left, right)
+	if len(lines) == 0 {
+		return
+	}
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, sub := range n.Nodes {
+				walk(sub)
+			}
+		case *parse.IfNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TextNode:
+			n.Text = cutRanges(n.Text, int(n.Pos), lines)
+		}
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil && t.Tree.ParseName == tmpl.Name() {
+			walk(t.Tree.Root)
+		}
+	}
+}
+
+// standaloneTags returns the byte ranges of the lines of text that only hold
+// a block action or a comment, including their line endings.
+func standaloneTags(text, left, right string) [][2]int {
+	var lines [][2]int
+	for start := 0; start < len(text); {
+		end := strings.IndexByte(text[start:], '\n') + start + 1
+		if end == start {
+			end = len(text)
+		}
+		line := strings.TrimSpace(text[start:end])
+		if strings.HasPrefix(line, left) && strings.HasSuffix(line, right) &&
+			strings.Count(line, left) == 1 && strings.Count(line, right) == 1 {
+			action := strings.TrimSuffix(strings.TrimPrefix(line[len(left):len(line)-len(right)], "-"), "-")
+			action = strings.TrimSpace(action)
+			keyword, _, _ := strings.Cut(action, " ")
+			if blockKeywords[keyword] || strings.HasPrefix(action, "/*") {
+				lines = append(lines, [2]int{start, end})
+			}
+		}
+		start = end
+	}
+	return lines
+}
+
+// cutRanges removes the bytes of text, which starts at offset pos of the
+// template, that lie within one of the ranges.
+func cutRanges(text []byte, pos int, ranges [][2]int) []byte {
+	var result []byte
+	for i, b := range text {
+		offset := pos + i
+		cut := false
+		for _, r := range ranges {
+			if offset >= r[0] && offset < r[1] {
+				cut = true
+				break
+			}
+		}
+		if !cut {
+			result = append(result, b)
+		}
+	}
+	return result
+}
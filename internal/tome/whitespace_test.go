@@ -0,0 +1,159 @@
+package tome
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWhitespaceApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		whitespace Whitespace
+		content    string
+		expected   string
+	}{
+		{
+			name:     "no options",
+			content:  "a  \n\n\n\nb",
+			expected: "a  \n\n\n\nb",
+		},
+		{
+			name:       "strip trailing whitespace",
+			whitespace: Whitespace{StripTrailingWhitespace: true},
+			content:    "a \t\nb  \r\n  c  ",
+			expected:   "a\nb\r\n  c",
+		},
+		{
+			name:       "collapse blank lines",
+			whitespace: Whitespace{CollapseBlankLines: true},
+			content:    "a\n\n  \n\nb\n\nc\n",
+			expected:   "a\n\nb\n\nc\n",
+		},
+		{
+			name:       "ensure trailing newline",
+			whitespace: Whitespace{EnsureTrailingNewline: true},
+			content:    "a\nb",
+			expected:   "a\nb\n",
+		},
+		{
+			name:       "ensure trailing newline keeps crlf",
+			whitespace: Whitespace{EnsureTrailingNewline: true},
+			content:    "a\r\nb",
+			expected:   "a\r\nb\r\n",
+		},
+		{
+			name:       "ensure trailing newline of empty output",
+			whitespace: Whitespace{EnsureTrailingNewline: true},
+			content:    "",
+			expected:   "",
+		},
+		{
+			name:       "lf line endings",
+			whitespace: Whitespace{LineEndings: "lf"},
+			content:    "a\r\nb\nc\r\n",
+			expected:   "a\nb\nc\n",
+		},
+		{
+			name:       "crlf line endings",
+			whitespace: Whitespace{LineEndings: "crlf", EnsureTrailingNewline: true},
+			content:    "a\nb\r\nc",
+			expected:   "a\r\nb\r\nc\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, string(tt.whitespace.Apply([]byte(tt.content))))
+		})
+	}
+}
+
+func TestTemplateTrimBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			name:     "range",
+			text:     "items:\n  {{ range .items }}\n  - {{ . }}\n  {{ end }}\ndone\n",
+			expected: "items:\n  - a\n  - b\ndone\n",
+		},
+		{
+			name:     "if else and comments",
+			text:     "{{/* header */}}\n{{ if .enabled }}\non\n{{/* trimmed */ -}}\n{{ else }}\noff\n{{ end }}\n",
+			expected: "on\n",
+		},
+		{
+			name:     "inline blocks are kept",
+			text:     "a: {{ if .enabled }}yes{{ end }}\n\nb\n",
+			expected: "a: yes\n\nb\n",
+		},
+		{
+			name:     "defined templates",
+			text:     "{{ define \"item\" }}\n- {{ . }}\n{{- end }}\n{{ range .items }}\n{{ template \"item\" . }}\n{{ end }}\n",
+			expected: "- a\n- b\n",
+		},
+		{
+			name:     "magic comment",
+			text:     "# templar: delims [[ ]]\n[[ range .items ]]\n[[ . ]]\n[[ end ]]\n",
+			expected: "a\nb\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tome := &Tome{
+				Whitespace: Whitespace{TrimBlocks: true},
+				Values:     map[string]any{"items": []any{"a", "b"}, "enabled": true},
+			}
+			var b bytes.Buffer
+			if assert.NoError(t, tome.Template(&b, tt.text, "test")) {
+				assert.Equal(t, tt.expected, b.String())
+			}
+		})
+	}
+}
+
+func TestRenderWithWhitespaceOptions(t *testing.T) {
+	in := t.TempDir()
+	out := t.TempDir()
+	files := map[string]string{
+		".tome.yaml":     "trimBlocks: true\nstripTrailingWhitespace: true\ncollapseBlankLines: true\nensureTrailingNewline: true\ncopy: ['**/*.bin']\n",
+		"list.txt":       "{{ range .items }}\n{{ . }}   \n\n\n{{ end }}",
+		"raw.bin":        "a  \n\n\n",
+		"win/.tome.yaml": "lineEndings: crlf\ncollapseBlankLines: false\n",
+		"win/config.ini": "[main]\n{{ if true }}\nkey=value\n{{ end }}\n\n\nend",
+	}
+	writeTree(t, in, files)
+
+	base, err := New(in, out, "", nil, nil, nil, nil, nil, map[string]any{"items": []any{"a", "b"}})
+	if err != nil {
+		t.Fatalf("failed to create tome: %v", err)
+	}
+	if err := base.Render(in); err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+
+	expected := map[string]string{
+		"list.txt":       "a\n\nb\n\n",
+		"raw.bin":        "a  \n\n\n",
+		"win/config.ini": "[main]\r\nkey=value\r\n\r\n\r\nend\r\n",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(out, name))
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, content, string(data), name)
+		}
+	}
+
+	tomeFile := filepath.Join(in, "invalid", ".tome.yaml")
+	os.MkdirAll(filepath.Dir(tomeFile), 0755)
+	os.WriteFile(tomeFile, []byte("lineEndings: cr\n"), 0644)
+	_, err = LoadTomeFile(tomeFile, base)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `invalid lineEndings "cr"`)
+	}
+}
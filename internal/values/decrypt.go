@@ -0,0 +1,474 @@
+package values
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ageBinaryHeader   = "age-encryption.org/v1\n"
+	sopsMetadataKey   = "sops"
+	sopsUnencrypted   = "_unencrypted"
+	sopsDataKeyLength = 32
+)
+
+// sopsMACOnlyEncryptedInit starts the MAC of files with mac_only_encrypted,
+// so it differs from the MAC of the same values without the option.
+var sopsMACOnlyEncryptedInit = []byte{0x8a, 0x3f, 0xd2, 0xad, 0x54, 0xce, 0x66, 0x52, 0x7b, 0x10, 0x34, 0xf3,
+	0xd1, 0x47, 0xbe, 0x0b, 0x0b, 0x97, 0x5b, 0x3b, 0xf4, 0x4f, 0x72, 0xc6, 0xfd, 0xad, 0xec, 0x81, 0x76, 0xf2, 0x7d, 0x69}
+
+// sopsValueRegexp matches a SOPS encrypted leaf value.
+var sopsValueRegexp = regexp.MustCompile(`^ENC\[AES256_GCM,data:([^,]*),iv:([^,]+),tag:([^,]+),type:([a-z]+)\]$`)
+
+// decryptValuesFile decrypts data if it is an age encrypted file or a SOPS
+// file with age recipients. It returns the parsed values and true if the
+// file was encrypted, or false if data should be parsed as plain YAML.
+// Every decrypted string is marked sensitive. ageKeyFile is an optional age
+// identity file.
+func decryptValuesFile(file string, data []byte, ageKeyFile string) (map[string]any, bool, error) {
+	if isAgeEncrypted(data) {
+		plaintext, err := decryptAge(data, ageKeyFile)
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to decrypt values file %s: %w", file, err)
+		}
+		var parsed map[string]any
+		if err := yaml.Unmarshal(plaintext, &parsed); err != nil {
+			return nil, true, fmt.Errorf("invalid YAML in decrypted file %s: %w", file, err)
+		}
+		markSensitiveStrings(parsed, nil)
+		return parsed, true, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || !isSopsDocument(&doc) {
+		return nil, false, nil
+	}
+	parsed, err := decryptSops(&doc, ageKeyFile)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to decrypt SOPS file %s: %w", file, err)
+	}
+	return parsed, true, nil
+}
+
+func isAgeEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ageBinaryHeader)) ||
+		bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header))
+}
+
+func decryptAge(data []byte, keyFile string) ([]byte, error) {
+	identities, err := loadAgeIdentities(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	var src io.Reader = bytes.NewReader(data)
+	if !bytes.HasPrefix(data, []byte(ageBinaryHeader)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// loadAgeIdentities collects age identities from keyFile, the
+// TEMPLAR_AGE_KEY(_FILE) and SOPS_AGE_KEY(_FILE) environment variables and
+// the default SOPS key file location.
+func loadAgeIdentities(keyFile string) ([]age.Identity, error) {
+	var identities []age.Identity
+
+	for _, env := range []string{"TEMPLAR_AGE_KEY", "SOPS_AGE_KEY"} {
+		if key := os.Getenv(env); key != "" {
+			ids, err := age.ParseIdentities(strings.NewReader(key))
+			if err != nil {
+				return nil, fmt.Errorf("invalid age key in %s: %w", env, err)
+			}
+			identities = append(identities, ids...)
+		}
+	}
+
+	keyFiles := []string{keyFile, os.Getenv("TEMPLAR_AGE_KEY_FILE"), os.Getenv("SOPS_AGE_KEY_FILE")}
+	if len(identities) == 0 && keyFiles[0] == "" && keyFiles[1] == "" && keyFiles[2] == "" {
+		if configDir, err := os.UserConfigDir(); err == nil {
+			defaultFile := filepath.Join(configDir, "sops", "age", "keys.txt")
+			if _, err := os.Stat(defaultFile); err == nil {
+				keyFiles = append(keyFiles, defaultFile)
+			}
+		}
+	}
+	for _, keyFile := range keyFiles {
+		if keyFile == "" {
+			continue
+		}
+		f, err := os.Open(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open age key file: %w", err)
+		}
+		ids, err := age.ParseIdentities(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid age key file %s: %w", keyFile, err)
+		}
+		identities = append(identities, ids...)
+	}
+
+	if len(identities) == 0 {
+		return nil, errors.New("no age identity found, use --age-key-file or set TEMPLAR_AGE_KEY")
+	}
+	return identities, nil
+}
+
+// isSopsDocument reports whether doc is a mapping with SOPS metadata.
+func isSopsDocument(doc *yaml.Node) bool {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return false
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == sopsMetadataKey && root.Content[i+1].Kind == yaml.MappingNode {
+			return true
+		}
+	}
+	return false
+}
+
+// sopsMetadata is the subset of the SOPS metadata needed to decrypt a file.
+type sopsMetadata struct {
+	Age []struct {
+		Recipient string `yaml:"recipient"`
+		Enc       string `yaml:"enc"`
+	} `yaml:"age"`
+	LastModified      string `yaml:"lastmodified"`
+	MAC               string `yaml:"mac"`
+	MACOnlyEncrypted  bool   `yaml:"mac_only_encrypted"`
+	UnencryptedSuffix string `yaml:"unencrypted_suffix"`
+	EncryptedSuffix   string `yaml:"encrypted_suffix"`
+	UnencryptedRegex  string `yaml:"unencrypted_regex"`
+	EncryptedRegex    string `yaml:"encrypted_regex"`
+}
+
+// decryptSops decrypts a SOPS document whose data key is encrypted for age
+// and verifies its message authentication code, which covers every value
+// of the file, or only the encrypted ones with mac_only_encrypted.
+func decryptSops(doc *yaml.Node, keyFile string) (map[string]any, error) {
+	root := doc.Content[0]
+	var metadata sopsMetadata
+	content := make([]*yaml.Node, 0, len(root.Content))
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == sopsMetadataKey {
+			if err := root.Content[i+1].Decode(&metadata); err != nil {
+				return nil, fmt.Errorf("invalid SOPS metadata: %w", err)
+			}
+			continue
+		}
+		content = append(content, root.Content[i], root.Content[i+1])
+	}
+	root.Content = content
+
+	if len(metadata.Age) == 0 {
+		return nil, errors.New("only SOPS files encrypted for age recipients are supported")
+	}
+	if metadata.MAC == "" {
+		return nil, errors.New("SOPS metadata has no MAC")
+	}
+	if metadata.UnencryptedSuffix == "" && metadata.EncryptedSuffix == "" &&
+		metadata.UnencryptedRegex == "" && metadata.EncryptedRegex == "" {
+		metadata.UnencryptedSuffix = sopsUnencrypted
+	}
+	isEncrypted, err := metadata.encryptedPaths()
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := sopsDataKey(metadata, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var leaves []sopsLeaf
+	collectSopsLeaves(doc, nil, nil, &leaves)
+	mac := sha512.New()
+	if metadata.MACOnlyEncrypted {
+		mac.Write(sopsMACOnlyEncryptedInit)
+	}
+	var secrets []sopsLeaf
+	// Aliased values are walked once per alias but decrypted only once
+	decrypted := map[*yaml.Node]any{}
+	for _, leaf := range leaves {
+		encrypted := isEncrypted(leaf.path)
+		value, done := decrypted[leaf.node]
+		if !done {
+			var err error
+			if value, err = leaf.decrypt(encrypted, dataKey); err != nil {
+				return nil, err
+			}
+			decrypted[leaf.node] = value
+		}
+		if value == nil {
+			continue
+		}
+		if encrypted || !metadata.MACOnlyEncrypted {
+			mac.Write(sopsMACBytes(value))
+		}
+		if _, ok := value.(string); ok && encrypted && !done {
+			secrets = append(secrets, leaf)
+		}
+	}
+
+	lastModified, err := time.Parse(time.RFC3339, metadata.LastModified)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOPS lastmodified %q: %w", metadata.LastModified, err)
+	}
+	expected, _, err := decryptSopsValue(metadata.MAC, dataKey, lastModified.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt SOPS MAC: %w", err)
+	}
+	if !hmac.Equal([]byte(expected), []byte(fmt.Sprintf("%X", mac.Sum(nil)))) {
+		return nil, errors.New("SOPS MAC mismatch, the file was modified after it was encrypted")
+	}
+
+	var parsed map[string]any
+	if err := root.Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("invalid decrypted values: %w", err)
+	}
+	for _, leaf := range secrets {
+		MarkSensitivePath(leaf.keyPath, leaf.node.Value)
+	}
+	return parsed, nil
+}
+
+// encryptedPaths returns a function reporting whether SOPS encrypts the
+// values at a path, following the suffix and regex options of the file.
+func (m sopsMetadata) encryptedPaths() (func(path []string) bool, error) {
+	var unencryptedRegex, encryptedRegex *regexp.Regexp
+	var err error
+	if m.UnencryptedRegex != "" {
+		if unencryptedRegex, err = regexp.Compile(m.UnencryptedRegex); err != nil {
+			return nil, fmt.Errorf("invalid SOPS unencrypted_regex: %w", err)
+		}
+	}
+	if m.EncryptedRegex != "" {
+		if encryptedRegex, err = regexp.Compile(m.EncryptedRegex); err != nil {
+			return nil, fmt.Errorf("invalid SOPS encrypted_regex: %w", err)
+		}
+	}
+	anyMatch := func(path []string, match func(string) bool) bool {
+		for _, p := range path {
+			if match(p) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(path []string) bool {
+		switch {
+		case m.UnencryptedSuffix != "":
+			return !anyMatch(path, func(p string) bool { return strings.HasSuffix(p, m.UnencryptedSuffix) })
+		case m.EncryptedSuffix != "":
+			return anyMatch(path, func(p string) bool { return strings.HasSuffix(p, m.EncryptedSuffix) })
+		case unencryptedRegex != nil:
+			return !anyMatch(path, unencryptedRegex.MatchString)
+		default:
+			return anyMatch(path, encryptedRegex.MatchString)
+		}
+	}, nil
+}
+
+// sopsLeaf is a scalar value of a SOPS document.
+type sopsLeaf struct {
+	node    *yaml.Node
+	path    []string // the mapping keys leading to the leaf
+	keyPath []string // path with listElement for list elements
+}
+
+// decrypt decrypts the leaf in place if it is encrypted and returns its
+// value, or nil for null values. Plain values are only accepted where the
+// file's options leave them unencrypted.
+func (l *sopsLeaf) decrypt(encrypted bool, key []byte) (any, error) {
+	additionalData := strings.Join(l.path, ":") + ":"
+	if encrypted {
+		if l.node.Tag == "!!null" {
+			return nil, nil
+		}
+		if !strings.HasPrefix(l.node.Value, "ENC[") {
+			return nil, fmt.Errorf("unencrypted value at %s, only keys matching the file's unencrypted options may be plain text", l)
+		}
+		value, tag, err := decryptSopsValue(l.node.Value, key, additionalData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", l, err)
+		}
+		l.node.Value = value
+		l.node.Tag = tag
+		l.node.Style = 0
+	}
+	var typed any
+	if err := l.node.Decode(&typed); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", l, err)
+	}
+	return typed, nil
+}
+
+func (l *sopsLeaf) String() string {
+	if len(l.keyPath) == 0 {
+		return "the document root"
+	}
+	return strings.Join(l.keyPath, ".")
+}
+
+// sopsMACBytes returns the bytes SOPS hashes into the MAC for a value.
+func sopsMACBytes(v any) []byte {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return []byte("True")
+		}
+		return []byte("False")
+	case int:
+		return []byte(strconv.Itoa(v))
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+	case time.Time:
+		return []byte(v.Format(time.RFC3339))
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+// collectSopsLeaves lists the scalar values below node in document order,
+// the order SOPS walks them to compute the MAC. Elements of a list share the
+// path of the list. Comments are not part of the MAC and are skipped.
+func collectSopsLeaves(node *yaml.Node, path, keyPath []string, leaves *[]sopsLeaf) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, item := range node.Content {
+			collectSopsLeaves(item, path, keyPath, leaves)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			collectSopsLeaves(node.Content[i+1], append(path[:len(path):len(path)], key),
+				append(keyPath[:len(keyPath):len(keyPath)], key), leaves)
+		}
+	case yaml.SequenceNode:
+		itemPath := append(keyPath[:len(keyPath):len(keyPath)], listElement)
+		for _, item := range node.Content {
+			collectSopsLeaves(item, path, itemPath, leaves)
+		}
+	case yaml.AliasNode:
+		collectSopsLeaves(node.Alias, path, keyPath, leaves)
+	case yaml.ScalarNode:
+		*leaves = append(*leaves, sopsLeaf{node: node, path: path, keyPath: keyPath})
+	}
+}
+
+// markSensitiveStrings marks every string below v as sensitive at its key path.
+func markSensitiveStrings(v any, path []string) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			markSensitiveStrings(value, append(path[:len(path):len(path)], key))
+		}
+	case []any:
+		for _, value := range v {
+			markSensitiveStrings(value, append(path[:len(path):len(path)], listElement))
+		}
+	case string:
+		MarkSensitivePath(path, v)
+	}
+}
+
+// sopsDataKey decrypts the data key with the first matching age identity.
+func sopsDataKey(metadata sopsMetadata, keyFile string) ([]byte, error) {
+	identities, err := loadAgeIdentities(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, entry := range metadata.Age {
+		r, err := age.Decrypt(armor.NewReader(strings.NewReader(strings.TrimSpace(entry.Enc))), identities...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		key, err := io.ReadAll(r)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(key) != sopsDataKeyLength {
+			return nil, fmt.Errorf("invalid SOPS data key length %d", len(key))
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("no age identity can decrypt the SOPS data key: %w", lastErr)
+}
+
+// decryptSopsValue decrypts a single SOPS value and returns its plaintext
+// together with the YAML tag for its type.
+func decryptSopsValue(value string, key []byte, additionalData string) (string, string, error) {
+	match := sopsValueRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return "", "", errors.New("unsupported encrypted value format")
+	}
+	var parts [3][]byte
+	for i := range parts {
+		decoded, err := base64.StdEncoding.DecodeString(match[i+1])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid encoding: %w", err)
+		}
+		parts[i] = decoded
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", "", err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return "", "", err
+	}
+	plaintext, err := gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return "", "", fmt.Errorf("authentication failed: %w", err)
+	}
+
+	switch match[4] {
+	case "str", "bytes", "comment":
+		return string(plaintext), "!!str", nil
+	case "int":
+		if _, err := strconv.ParseInt(string(plaintext), 10, 64); err != nil {
+			return "", "", fmt.Errorf("invalid int value: %w", err)
+		}
+		return string(plaintext), "!!int", nil
+	case "float":
+		if _, err := strconv.ParseFloat(string(plaintext), 64); err != nil {
+			return "", "", fmt.Errorf("invalid float value: %w", err)
+		}
+		return string(plaintext), "!!float", nil
+	case "bool":
+		b, err := strconv.ParseBool(string(plaintext))
+		if err != nil {
+			return "", "", fmt.Errorf("invalid bool value: %w", err)
+		}
+		return strconv.FormatBool(b), "!!bool", nil
+	default:
+		return "", "", fmt.Errorf("unsupported value type %q", match[4])
+	}
+}
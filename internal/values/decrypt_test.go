@@ -0,0 +1,293 @@
+package values
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupAgeKey creates an age identity and returns its recipient and the
+// options to load values files with it.
+func setupAgeKey(t *testing.T) (*age.X25519Recipient, LoadOptions) {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate identity: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(keyFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	return identity.Recipient(), LoadOptions{AgeKeyFile: keyFile}
+}
+
+func ageEncrypt(t *testing.T, recipient age.Recipient, plaintext string, armored bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var out io.Writer = &buf
+	var armorWriter io.WriteCloser
+	if armored {
+		armorWriter = armor.NewWriter(&buf)
+		out = armorWriter
+	}
+	enc, err := age.Encrypt(out, recipient)
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	enc.Write([]byte(plaintext))
+	enc.Close()
+	if armorWriter != nil {
+		armorWriter.Close()
+	}
+	return buf.Bytes()
+}
+
+// sopsEncrypt encrypts a value the way SOPS does with AES256_GCM.
+func sopsEncrypt(t *testing.T, key []byte, plaintext, typ, additionalData string) string {
+	t.Helper()
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCMWithNonceSize(block, 32)
+	iv := make([]byte, 32)
+	rand.Read(iv)
+	sealed := gcm.Seal(nil, iv, []byte(plaintext), []byte(additionalData))
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]",
+		base64.StdEncoding.EncodeToString(data), base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(tag), typ)
+}
+
+func TestLoadAndMergeAgeEncrypted(t *testing.T) {
+	t.Cleanup(resetSensitive)
+	recipient, opts := setupAgeKey(t)
+	tempDir := t.TempDir()
+
+	for _, armored := range []bool{false, true} {
+		t.Run(fmt.Sprintf("armored=%v", armored), func(t *testing.T) {
+			file := filepath.Join(tempDir, fmt.Sprintf("secrets-%v.yaml.age", armored))
+			content := ageEncrypt(t, recipient, "db:\n  password: hunter2-age\n  port: 5432\n", armored)
+			if err := os.WriteFile(file, content, 0600); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			result, err := LoadAndMerge([]string{file}, nil, nil, nil, nil, opts)
+			if err != nil {
+				t.Fatalf("LoadAndMerge failed: %v", err)
+			}
+			assert.Equal(t, map[string]any{"db": map[string]any{"password": "hunter2-age", "port": 5432}}, result)
+			assert.True(t, IsSensitive("hunter2-age"))
+			assert.Equal(t, "port 5432", RedactString("port 5432"))
+		})
+	}
+}
+
+// sopsMAC encrypts the SOPS MAC of the given cleartext leaves, in file order.
+func sopsMAC(t *testing.T, key []byte, lastModified string, leaves ...string) string {
+	t.Helper()
+	hash := sha512.New()
+	for _, leaf := range leaves {
+		hash.Write([]byte(leaf))
+	}
+	return sopsEncrypt(t, key, fmt.Sprintf("%X", hash.Sum(nil)), "str", lastModified)
+}
+
+func TestLoadAndMergeSops(t *testing.T) {
+	t.Cleanup(resetSensitive)
+	recipient, opts := setupAgeKey(t)
+	dataKey := make([]byte, 32)
+	rand.Read(dataKey)
+
+	var encKey bytes.Buffer
+	aw := armor.NewWriter(&encKey)
+	enc, _ := age.Encrypt(aw, recipient)
+	enc.Write(dataKey)
+	enc.Close()
+	aw.Close()
+
+	const lastModified = "2024-05-01T10:00:00Z"
+	document := fmt.Sprintf(`#%s
+db:
+  user: %s
+  password: %s
+  port: %s
+  tls: %s
+  host_unencrypted: db.internal
+hosts:
+  - %s
+`,
+		sopsEncrypt(t, dataKey, " database settings", "comment", ":"),
+		sopsEncrypt(t, dataKey, "admin", "str", "db:user:"),
+		sopsEncrypt(t, dataKey, "hunter2-sops", "str", "db:password:"),
+		sopsEncrypt(t, dataKey, "5432", "int", "db:port:"),
+		sopsEncrypt(t, dataKey, "True", "bool", "db:tls:"),
+		sopsEncrypt(t, dataKey, "10.0.0.1", "str", "hosts:"),
+	)
+	metadata := func(mac string) string {
+		return fmt.Sprintf(`sops:
+  age:
+    - recipient: %s
+      enc: |
+%s
+  lastmodified: "%s"
+  mac: %s
+  unencrypted_suffix: _unencrypted
+  version: 3.8.1
+`,
+			recipient.String(),
+			"        "+strings.ReplaceAll(strings.TrimSpace(encKey.String()), "\n", "\n        "),
+			lastModified, mac)
+	}
+	mac := sopsMAC(t, dataKey, lastModified, "admin", "hunter2-sops", "5432", "True", "db.internal", "10.0.0.1")
+	content := document + metadata(mac)
+	load := func(t *testing.T, content string) (map[string]any, error) {
+		file := filepath.Join(t.TempDir(), "secrets.enc.yaml")
+		if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		return LoadAndMerge([]string{file}, nil, nil, nil, nil, opts)
+	}
+
+	result, err := load(t, content)
+	if err != nil {
+		t.Fatalf("LoadAndMerge failed: %v", err)
+	}
+	expected := map[string]any{
+		"db": map[string]any{
+			"user":             "admin",
+			"password":         "hunter2-sops",
+			"port":             5432,
+			"tls":              true,
+			"host_unencrypted": "db.internal",
+		},
+		"hosts": []any{"10.0.0.1"},
+	}
+	assert.Equal(t, expected, result)
+	assert.True(t, IsSensitive("hunter2-sops"))
+	assert.True(t, IsSensitive("10.0.0.1"))
+	assert.False(t, IsSensitive("db.internal"))
+	assert.Equal(t, "port 5432, tls true", RedactString("port 5432, tls true"), "only encrypted strings are scrubbed from text")
+	assert.Equal(t, map[string]any{
+		"db": map[string]any{
+			"user":             Redacted,
+			"password":         Redacted,
+			"port":             5432,
+			"tls":              true,
+			"host_unencrypted": "db.internal",
+		},
+		"hosts": []any{Redacted},
+	}, Redact(result))
+
+	t.Run("Tampered path fails authentication", func(t *testing.T) {
+		_, err := load(t, strings.Replace(content, "  password:", "  passwd:", 1))
+		assert.Error(t, err)
+	})
+
+	t.Run("Injected plain value is rejected", func(t *testing.T) {
+		_, err := load(t, strings.Replace(content, "hosts:\n", "admin: injected\nhosts:\n", 1))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "unencrypted value at admin")
+		}
+	})
+
+	t.Run("Removed value fails the MAC", func(t *testing.T) {
+		lines := strings.Split(content, "\n")
+		for i, line := range lines {
+			if strings.HasPrefix(line, "  tls:") {
+				lines = append(lines[:i], lines[i+1:]...)
+				break
+			}
+		}
+		_, err := load(t, strings.Join(lines, "\n"))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "MAC mismatch")
+		}
+	})
+
+	t.Run("Changed unencrypted value fails the MAC", func(t *testing.T) {
+		_, err := load(t, strings.Replace(content, "db.internal", "evil.example.com", 1))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "MAC mismatch")
+		}
+	})
+
+	t.Run("Missing MAC is rejected", func(t *testing.T) {
+		_, err := load(t, strings.Replace(content, "  mac: "+mac+"\n", "", 1))
+		assert.Error(t, err)
+	})
+}
+
+// TestLoadAndMergeSopsFixtures decrypts files encrypted by the sops 3.9.1
+// CLI for the age key in testdata, with the default unencrypted suffix,
+// with --encrypted-regex and with --mac-only-encrypted.
+func TestLoadAndMergeSopsFixtures(t *testing.T) {
+	t.Cleanup(resetSensitive)
+	opts := LoadOptions{AgeKeyFile: filepath.Join("testdata", "age-test-key.txt")}
+	expected := map[string]any{
+		"db": map[string]any{
+			"user":             "admin",
+			"password":         "hunter2-sops",
+			"port":             5432,
+			"tls":              true,
+			"ratio":            0.5,
+			"host_unencrypted": "db.internal",
+		},
+		"hosts": []any{"10.0.0.1", "10.0.0.2"},
+	}
+
+	for file, macCoversPlain := range map[string]bool{
+		"secrets.sops.yaml":            true,
+		"regex.sops.yaml":              true,
+		"mac-only-encrypted.sops.yaml": false,
+	} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join("testdata", file)
+			result, err := LoadAndMerge([]string{path}, nil, nil, nil, nil, opts)
+			if err != nil {
+				t.Fatalf("LoadAndMerge failed: %v", err)
+			}
+			assert.Equal(t, expected, result)
+			assert.True(t, IsSensitive("hunter2-sops"))
+			assert.False(t, IsSensitive("db.internal"))
+
+			// Changing a plain value breaks the MAC, unless it only covers encrypted values
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read fixture: %v", err)
+			}
+			tampered := filepath.Join(t.TempDir(), file)
+			if err := os.WriteFile(tampered, []byte(strings.Replace(string(data), "db.internal", "db.evil", 1)), 0600); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+			_, err = LoadAndMerge([]string{tampered}, nil, nil, nil, nil, opts)
+			if !macCoversPlain {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "MAC mismatch")
+			}
+		})
+	}
+}
+
+func TestLoadAndMergeEncryptedWithoutKey(t *testing.T) {
+	recipient, opts := setupAgeKey(t)
+	opts.AgeKeyFile = filepath.Join(t.TempDir(), "missing.txt")
+
+	file := filepath.Join(t.TempDir(), "secrets.yaml.age")
+	if err := os.WriteFile(file, ageEncrypt(t, recipient, "a: b\n", false), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	_, err := LoadAndMerge([]string{file}, nil, nil, nil, nil, opts)
+	assert.Error(t, err)
+}
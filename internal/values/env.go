@@ -0,0 +1,264 @@
+package values
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envVarRegexp matches the escaped form ${{VAR}} (group 1) or a reference
+// ${VAR}, ${VAR-default}, ${VAR:-default}, ${VAR?message} or ${VAR:?message}
+// (name in group 2, operator in group 3, argument in group 4).
+var envVarRegexp = regexp.MustCompile(`\$\{\{([^{}]*)\}\}|\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:?[-?])([^}]*))?\}`)
+
+// blockHeaderRegexp matches the indicator of a literal (|) or folded (>)
+// block scalar at the end of a line, with optional chomping and indentation
+// indicators and comment.
+var blockHeaderRegexp = regexp.MustCompile(`[|>](?:[1-9][+-]?|[+-][1-9]?)?[ \t]*(?:[ \t]#.*)?$`)
+
+// scalarContext describes where in a YAML line a substitution takes place.
+type scalarContext int
+
+const (
+	contextPlain scalarContext = iota
+	contextDoubleQuoted
+	contextSingleQuoted
+	contextComment
+	contextBlock
+)
+
+// SubstituteEnvVars replaces ${VAR} with the corresponding environment variable.
+// Shell-style ${VAR:-default} and ${VAR:?message} are supported, the latter
+// failing when VAR is unset or empty. Substituted values are quoted as needed
+// for the surrounding YAML so they cannot change the document structure.
+// Inside literal and folded block scalars, values are inserted verbatim,
+// with their lines indented like the block. Escaped form ${{VAR}} is
+// preserved as literal ${VAR}, and comments are left untouched.
+func SubstituteEnvVars(yamlContent string) (string, error) {
+	var result strings.Builder
+	blocks := blockScalarIndents(yamlContent)
+	last := 0
+	for _, m := range envVarRegexp.FindAllStringSubmatchIndex(yamlContent, -1) {
+		start, end := m[0], m[1]
+		result.WriteString(yamlContent[last:start])
+		last = end
+
+		lineStart := strings.LastIndex(yamlContent[:start], "\n") + 1
+		blockIndent, inBlock := blocks[lineStart]
+		ctx := contextBlock
+		if !inBlock {
+			ctx = lineContext(yamlContent[lineStart:start])
+		}
+		if ctx == contextComment {
+			result.WriteString(yamlContent[start:end])
+			continue
+		}
+
+		// Escaped ${{VAR}}
+		if m[2] >= 0 {
+			result.WriteString("${" + yamlContent[m[2]:m[3]] + "}")
+			continue
+		}
+
+		name := yamlContent[m[4]:m[5]]
+		var op, arg string
+		if m[6] >= 0 {
+			op = yamlContent[m[6]:m[7]]
+			arg = yamlContent[m[8]:m[9]]
+		}
+		value, err := expandEnvVar(name, op, arg)
+		if err != nil {
+			return "", err
+		}
+		if ctx == contextBlock {
+			result.WriteString(strings.ReplaceAll(value, "\n", "\n"+blockIndent))
+			continue
+		}
+
+		lineEnd := strings.IndexByte(yamlContent[end:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(yamlContent)
+		} else {
+			lineEnd += end
+		}
+		quoted, err := quoteForContext(value, ctx,
+			yamlContent[lineStart:start], yamlContent[end:lineEnd])
+		if err != nil {
+			return "", fmt.Errorf("cannot substitute ${%s}: %w", name, err)
+		}
+		result.WriteString(quoted)
+	}
+	result.WriteString(yamlContent[last:])
+	return result.String(), nil
+}
+
+// expandEnvVar looks up an environment variable and applies the shell-style
+// operator ("-", ":-", "?" or ":?") to it.
+func expandEnvVar(name, op, arg string) (string, error) {
+	value, set := os.LookupEnv(name)
+	switch op {
+	case "-":
+		if !set {
+			return arg, nil
+		}
+	case ":-":
+		if value == "" {
+			return arg, nil
+		}
+	case "?", ":?":
+		if !set || (op == ":?" && value == "") {
+			if arg == "" {
+				arg = "parameter null or not set"
+			}
+			return "", fmt.Errorf("environment variable %s: %s", name, arg)
+		}
+	}
+	return value, nil
+}
+
+// blockScalarIndents returns the indentation of the block scalar each line
+// of content belongs to, by the offset of the line, for the lines inside a
+// literal or folded block scalar.
+func blockScalarIndents(content string) map[int]string {
+	indents := map[int]string{}
+	inBlock, parent, indent := false, 0, ""
+	for start := 0; start < len(content); {
+		end := strings.IndexByte(content[start:], '\n') + start + 1
+		if end == start {
+			end = len(content)
+		}
+		line := strings.TrimRight(content[start:end], "\r\n")
+		trimmed := strings.TrimLeft(line, " ")
+		lineIndent := len(line) - len(trimmed)
+		blank := strings.TrimSpace(line) == ""
+		if inBlock && (blank || lineIndent > parent) {
+			if indent == "" && !blank {
+				indent = line[:lineIndent]
+			}
+			indents[start] = indent
+		} else {
+			inBlock, parent, indent = isBlockHeader(line), lineIndent, ""
+		}
+		start = end
+	}
+	return indents
+}
+
+// isBlockHeader reports whether a line ends with the indicator of a block
+// scalar, outside of quotes and comments.
+func isBlockHeader(line string) bool {
+	loc := blockHeaderRegexp.FindStringIndex(line)
+	if loc == nil {
+		return false
+	}
+	prefix := line[:loc[0]]
+	return startsScalar(prefix) && lineContext(prefix) == contextPlain
+}
+
+// lineContext determines whether the end of the given line prefix is inside
+// a plain scalar, a quoted scalar or a comment.
+func lineContext(prefix string) scalarContext {
+	ctx := contextPlain
+	for i := 0; i < len(prefix); i++ {
+		c := prefix[i]
+		switch ctx {
+		case contextPlain:
+			switch {
+			case c == '#' && (i == 0 || prefix[i-1] == ' ' || prefix[i-1] == '\t'):
+				return contextComment
+			case (c == '"' || c == '\'') && startsScalar(prefix[:i]):
+				if c == '"' {
+					ctx = contextDoubleQuoted
+				} else {
+					ctx = contextSingleQuoted
+				}
+			}
+		case contextDoubleQuoted:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				ctx = contextPlain
+			}
+		case contextSingleQuoted:
+			if c == '\'' {
+				if i+1 < len(prefix) && prefix[i+1] == '\'' {
+					i++
+				} else {
+					ctx = contextPlain
+				}
+			}
+		}
+	}
+	return ctx
+}
+
+// startsScalar reports whether a scalar may start after the given line prefix,
+// i.e. it is empty or ends in an indicator such as "key: ", "- " or "[".
+func startsScalar(prefix string) bool {
+	trimmed := strings.TrimRight(prefix, " \t")
+	if trimmed == "" {
+		return true
+	}
+	spaced := len(trimmed) < len(prefix)
+	switch trimmed[len(trimmed)-1] {
+	case '[', '{', ',':
+		return true
+	case ':', '?':
+		return spaced
+	case '-':
+		rest := trimmed[:len(trimmed)-1]
+		return spaced && (rest == "" || strings.HasSuffix(rest, " ") || strings.HasSuffix(rest, "\t"))
+	}
+	return false
+}
+
+// quoteForContext renders value so that it keeps its meaning in the given context.
+func quoteForContext(value string, ctx scalarContext, before, after string) (string, error) {
+	switch ctx {
+	case contextDoubleQuoted:
+		b, _ := json.Marshal(value)
+		return string(b[1 : len(b)-1]), nil
+	case contextSingleQuoted:
+		if strings.ContainsAny(value, "\n\r") {
+			return "", fmt.Errorf("value contains a line break and cannot be placed in a single-quoted string")
+		}
+		return strings.ReplaceAll(value, "'", "''"), nil
+	}
+
+	trimmedAfter := strings.TrimLeft(after, " \t")
+	wholeScalar := startsScalar(before) &&
+		(trimmedAfter == "" || strings.ContainsAny(trimmedAfter[:1], "#,]}"))
+	if wholeScalar {
+		if isPlainScalar(value) {
+			return value, nil
+		}
+		b, _ := json.Marshal(value)
+		return string(b), nil
+	}
+
+	// Part of a larger plain scalar, e.g. "url: http://${HOST}:8080"
+	if strings.ContainsAny(value, "\n\r\t") || strings.Contains(value, ": ") ||
+		strings.Contains(value, " #") || strings.HasSuffix(value, ":") {
+		return "", fmt.Errorf("value %q is not safe inside an unquoted string, quote the surrounding value", value)
+	}
+	return value, nil
+}
+
+// isPlainScalar reports whether value can be written as an unquoted YAML
+// scalar and read back unchanged. Integers with leading zeros are excluded
+// so they stay strings.
+func isPlainScalar(value string) bool {
+	if value == "" || strings.ContainsAny(value, "\n\r") || leadingZeroRegexp.MatchString(value) {
+		return false
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &node); err != nil || len(node.Content) != 1 {
+		return false
+	}
+	scalar := node.Content[0]
+	return scalar.Kind == yaml.ScalarNode && scalar.Style == 0 && scalar.Value == value
+}
@@ -0,0 +1,106 @@
+package values
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSubstituteEnvVars(t *testing.T) {
+	t.Setenv("HOST", "example.com")
+	t.Setenv("PORT", "8080")
+	t.Setenv("ZIP", "01234")
+	t.Setenv("FLAG", "true")
+	t.Setenv("EMPTY", "")
+	t.Setenv("TRICKY", "a: b # not a comment")
+	t.Setenv("QUOTES", `say "hi" it's`)
+	t.Setenv("MULTILINE", "line1\nline2")
+	t.Setenv("CERT", "-----BEGIN-----\nabc\n-----END-----")
+	os.Unsetenv("UNSET")
+
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		expectError bool
+	}{
+		{name: "Plain value", input: "host: ${HOST}", expected: "host: example.com"},
+		{name: "Keeps scalar types", input: "port: ${PORT}\nflag: ${FLAG}", expected: "port: 8080\nflag: true"},
+		{name: "Leading zeros are quoted", input: "zip: ${ZIP}", expected: `zip: "01234"`},
+		{name: "Part of a plain scalar", input: "url: http://${HOST}:${PORT}/", expected: "url: http://example.com:8080/"},
+		{name: "Unset becomes empty string", input: "key: ${UNSET}", expected: `key: ""`},
+		{name: "Default when unset", input: "key: ${UNSET:-fallback}", expected: "key: fallback"},
+		{name: "Default when empty", input: "key: ${EMPTY:-fallback}", expected: "key: fallback"},
+		{name: "Dash default keeps empty", input: "key: ${EMPTY-fallback}", expected: `key: ""`},
+		{name: "Default not used when set", input: "key: ${HOST:-fallback}", expected: "key: example.com"},
+		{name: "Required and set", input: "key: ${HOST:?host is required}", expected: "key: example.com"},
+		{name: "Required and unset", input: "key: ${UNSET:?UNSET is required}", expectError: true},
+		{name: "Required and empty", input: "key: ${EMPTY:?}", expectError: true},
+		{name: "Question mark allows empty", input: "key: ${EMPTY?}", expected: `key: ""`},
+		{name: "Structural characters are quoted", input: "key: ${TRICKY}", expected: `key: "a: b # not a comment"`},
+		{name: "Unsafe inside plain scalar", input: "key: x${TRICKY}", expectError: true},
+		{name: "Double-quoted context", input: `key: "<${QUOTES}>"`, expected: `key: "<say \"hi\" it's>"`},
+		{name: "Single-quoted context", input: `key: '<${QUOTES}>'`, expected: `key: '<say "hi" it''s>'`},
+		{name: "Multiline value", input: "key: ${MULTILINE}", expected: `key: "line1\nline2"`},
+		{name: "List item", input: "- ${ZIP}", expected: `- "01234"`},
+		{name: "Flow sequence", input: "list: [${ZIP}, ${PORT}]", expected: `list: ["01234", 8080]`},
+		{name: "Escaped variable", input: "key: ${{HOST}}", expected: "key: ${HOST}"},
+		{name: "Comments are untouched", input: "key: 1 # ${UNSET:?not evaluated}", expected: "key: 1 # ${UNSET:?not evaluated}"},
+		{name: "Template braces are untouched", input: `key: "{{ .Values.x }}"`, expected: `key: "{{ .Values.x }}"`},
+		{name: "Invalid names are untouched", input: "key: ${not valid}", expected: "key: ${not valid}"},
+		{name: "Literal block", input: "cert: |\n  ${CERT}\nnext: 1", expected: "cert: |\n  -----BEGIN-----\n  abc\n  -----END-----\nnext: 1"},
+		{name: "Folded block", input: "script: >-\n    run ${TRICKY}\n    now\n", expected: "script: >-\n    run a: b # not a comment\n    now\n"},
+		{name: "Block in a list", input: "- |\n  ${MULTILINE}\n- ${PORT}", expected: "- |\n  line1\n  line2\n- 8080"},
+		{name: "Block keeps hashes", input: "run: |\n  echo # ${HOST}\n", expected: "run: |\n  echo # example.com\n"},
+		{name: "Block with blank lines", input: "a: |\n\n    x\n\n    ${MULTILINE}\nb: ${ZIP}", expected: "a: |\n\n    x\n\n    line1\n    line2\nb: \"01234\""},
+		{name: "Quoted pipe is not a block", input: "a: '|'\nb: ${TRICKY}", expected: "a: '|'\nb: \"a: b # not a comment\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := SubstituteEnvVars(tt.input)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+
+			var parsed any
+			assert.NoError(t, yaml.Unmarshal([]byte(result), &parsed), "result is not valid YAML")
+		})
+	}
+}
+
+func TestSubstituteEnvVarsBlockScalars(t *testing.T) {
+	cert := "-----BEGIN-----\nabc # def\n-----END-----"
+	t.Setenv("CERT", cert)
+	t.Setenv("CMD", "a: b")
+
+	result, err := SubstituteEnvVars("tls:\n  cert: |\n    ${CERT}\n  script: |-\n    ${CMD}\n  folded: >\n    ${CMD}\n")
+	if err != nil {
+		t.Fatalf("SubstituteEnvVars failed: %v", err)
+	}
+	var parsed map[string]map[string]string
+	if assert.NoError(t, yaml.Unmarshal([]byte(result), &parsed)) {
+		assert.Equal(t, cert+"\n", parsed["tls"]["cert"])
+		assert.Equal(t, "a: b", parsed["tls"]["script"])
+		assert.Equal(t, "a: b\n", parsed["tls"]["folded"])
+	}
+}
+
+func TestLoadAndMergeNoEnvSubst(t *testing.T) {
+	t.Setenv("HOST", "example.com")
+	file := t.TempDir() + "/values.yaml"
+	if err := os.WriteFile(file, []byte(`host: "${HOST}"`), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	result, err := LoadAndMerge([]string{file}, nil, nil, nil, nil, LoadOptions{NoEnvSubst: true})
+	if err != nil {
+		t.Fatalf("LoadAndMerge failed: %v", err)
+	}
+	assert.Equal(t, map[string]any{"host": "${HOST}"}, result)
+}
@@ -0,0 +1,302 @@
+package values
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is a compiled JSON Schema used to validate values.
+type Schema struct {
+	Path     string
+	document map[string]any
+	compiled *jsonschema.Schema
+}
+
+// SchemaViolation is a single validation failure at a JSON pointer path.
+type SchemaViolation struct {
+	Path    string
+	Message string
+}
+
+// SchemaError lists every violation found while validating against a schema.
+type SchemaError struct {
+	Schema     string
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	lines := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		lines[i] = fmt.Sprintf("  %s: %s", v.Path, v.Message)
+	}
+	return fmt.Sprintf("values do not match schema %s:\n%s", e.Schema, strings.Join(lines, "\n"))
+}
+
+// LoadSchema reads and compiles a JSON Schema from a JSON or YAML file.
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema file %s: %w", path, err)
+	}
+
+	// Accept YAML as well as JSON by normalizing to JSON first
+	var document map[string]any
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid schema file %s: %w", path, err)
+	}
+	jsonData, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema file %s: %w", path, err)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve schema path %s: %w", path, err)
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(absPath, bytes.NewReader(jsonData)); err != nil {
+		return nil, fmt.Errorf("failed to load schema %s: %w", path, err)
+	}
+	compiled, err := compiler.Compile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema %s: %w", path, err)
+	}
+
+	return &Schema{Path: path, document: document, compiled: compiled}, nil
+}
+
+// Validate checks v against the schema and returns a *SchemaError listing
+// every violation. The internal "__tome__" key is ignored.
+func (s *Schema) Validate(v any) error {
+	if m, ok := v.(map[string]any); ok {
+		if _, ok := m["__tome__"]; ok {
+			trimmed := make(map[string]any, len(m))
+			for key, value := range m {
+				if key != "__tome__" {
+					trimmed[key] = value
+				}
+			}
+			v = trimmed
+		}
+	}
+
+	// Round-trip through JSON so YAML specific types (timestamps, ints)
+	// are presented to the validator as plain JSON values
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to prepare values for validation: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var instance any
+	if err := decoder.Decode(&instance); err != nil {
+		return fmt.Errorf("failed to prepare values for validation: %w", err)
+	}
+
+	err = s.compiled.Validate(instance)
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return fmt.Errorf("failed to validate against schema %s: %w", s.Path, err)
+	}
+
+	schemaErr := &SchemaError{Schema: s.Path}
+	collectViolations(validationErr, &schemaErr.Violations)
+	sort.SliceStable(schemaErr.Violations, func(i, j int) bool {
+		return schemaErr.Violations[i].Path < schemaErr.Violations[j].Path
+	})
+	return schemaErr
+}
+
+// collectViolations gathers the leaf errors of a validation error tree.
+func collectViolations(err *jsonschema.ValidationError, violations *[]SchemaViolation) {
+	if len(err.Causes) == 0 {
+		path := err.InstanceLocation
+		if path == "" {
+			path = "/"
+		}
+		*violations = append(*violations, SchemaViolation{Path: path, Message: err.Message})
+		return
+	}
+	for _, cause := range err.Causes {
+		collectViolations(cause, violations)
+	}
+}
+
+// ApplyDefaults sets the schema's "default" for every property missing in
+// vals, descending into nested object properties.
+func (s *Schema) ApplyDefaults(vals map[string]any) {
+	applyDefaults(s.document, vals)
+}
+
+func applyDefaults(schema map[string]any, vals map[string]any) {
+	properties, _ := schema["properties"].(map[string]any)
+	for key, raw := range properties {
+		propSchema, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		current, exists := vals[key]
+		if !exists {
+			if def, ok := propSchema["default"]; ok {
+				vals[key] = DeepCopy(def)
+				continue
+			}
+			// Create missing objects when their properties have defaults
+			nested := map[string]any{}
+			applyDefaults(propSchema, nested)
+			if len(nested) > 0 {
+				vals[key] = nested
+			}
+			continue
+		}
+		if nested, ok := current.(map[string]any); ok {
+			applyDefaults(propSchema, nested)
+		}
+	}
+}
+
+// MarkSensitive marks the values of all properties declared with
+// "secret": true in the schema as sensitive.
+func (s *Schema) MarkSensitive(vals map[string]any) {
+	markSchemaSecrets(s.document, vals, nil)
+}
+
+func markSchemaSecrets(schema map[string]any, v any, path []string) {
+	if secret, _ := schema["secret"].(bool); secret {
+		MarkSensitivePath(path, v)
+		return
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		for key, raw := range properties {
+			if propSchema, ok := raw.(map[string]any); ok {
+				if value, ok := v[key]; ok {
+					markSchemaSecrets(propSchema, value, append(path[:len(path):len(path)], key))
+				}
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for _, item := range v {
+				markSchemaSecrets(items, item, append(path[:len(path):len(path)], listElement))
+			}
+		}
+	}
+}
+
+// ConvertStrings converts the strings at the given key paths to the
+// integer, number or boolean the schema declares for them, if they parse as
+// one. Strings whose schema also allows a string are kept. List elements are
+// addressed by their index.
+func (s *Schema) ConvertStrings(vals map[string]any, paths [][]string) {
+	for _, path := range paths {
+		convertString(s.document, vals, path)
+	}
+}
+
+func convertString(schema map[string]any, v any, path []string) {
+	if len(path) == 0 || schema == nil {
+		return
+	}
+	key := path[0]
+	switch container := v.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		propSchema, _ := properties[key].(map[string]any)
+		if len(path) > 1 {
+			convertString(propSchema, container[key], path[1:])
+		} else if converted, ok := convertScalar(propSchema, container[key]); ok {
+			container[key] = converted
+		}
+	case []any:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(container) {
+			return
+		}
+		items, _ := schema["items"].(map[string]any)
+		if len(path) > 1 {
+			convertString(items, container[index], path[1:])
+		} else if converted, ok := convertScalar(items, container[index]); ok {
+			container[index] = converted
+		}
+	}
+}
+
+// convertScalar converts a string to the first of the integer, number or
+// boolean types allowed by schema it parses as.
+func convertScalar(schema map[string]any, v any) (any, bool) {
+	str, ok := v.(string)
+	if !ok || schema == nil {
+		return nil, false
+	}
+	var types []string
+	switch t := schema["type"].(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				types = append(types, name)
+			}
+		}
+	}
+	for _, t := range types {
+		if t == "string" {
+			return nil, false
+		}
+	}
+	str = strings.TrimSpace(str)
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if n, err := strconv.Atoi(str); err == nil {
+				return n, true
+			}
+		case "number":
+			if n, err := strconv.Atoi(str); err == nil {
+				return n, true
+			}
+			if f, err := strconv.ParseFloat(str, 64); err == nil {
+				return f, true
+			}
+		case "boolean":
+			if str == "true" || str == "false" {
+				return str == "true", true
+			}
+		}
+	}
+	return nil, false
+}
+
+// DeepCopy copies maps and slices recursively, so the copy shares no state with v.
+func DeepCopy(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for key, value := range v {
+			c[key] = DeepCopy(value)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, value := range v {
+			c[i] = DeepCopy(value)
+		}
+		return c
+	default:
+		return v
+	}
+}
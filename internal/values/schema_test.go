@@ -0,0 +1,125 @@
+package values
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = `{
+  "type": "object",
+  "required": ["app"],
+  "properties": {
+    "app": {
+      "type": "object",
+      "required": ["name"],
+      "properties": {
+        "name": {"type": "string"},
+        "replicas": {"type": "integer", "minimum": 1, "default": 1},
+        "ports": {"type": "array", "items": {"type": "integer"}}
+      },
+      "additionalProperties": false
+    },
+    "image": {
+      "type": "object",
+      "properties": {
+        "repository": {"type": "string", "default": "nginx"},
+        "tag": {"type": "string", "default": "latest"}
+      }
+    }
+  }
+}`
+
+func writeSchema(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create schema file: %v", err)
+	}
+	return path
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := LoadSchema(writeSchema(t, "values.schema.json", testSchema))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	t.Run("Valid values", func(t *testing.T) {
+		vals := map[string]any{
+			"app":      map[string]any{"name": "web", "replicas": 3, "ports": []any{80, 443}},
+			"__tome__": map[string]any{"source": "templates"},
+		}
+		assert.NoError(t, schema.Validate(vals))
+	})
+
+	t.Run("Reports every violation", func(t *testing.T) {
+		vals := map[string]any{
+			"app": map[string]any{"replicas": 0, "ports": []any{80, "https"}, "extra": true},
+		}
+		err := schema.Validate(vals)
+		var schemaErr *SchemaError
+		if !errors.As(err, &schemaErr) {
+			t.Fatalf("expected *SchemaError, got %v", err)
+		}
+		paths := []string{}
+		for _, v := range schemaErr.Violations {
+			paths = append(paths, v.Path)
+		}
+		assert.Equal(t, []string{"/app", "/app", "/app/ports/1", "/app/replicas"}, paths)
+		assert.Contains(t, err.Error(), "/app/ports/1")
+	})
+
+	t.Run("Missing required root key", func(t *testing.T) {
+		err := schema.Validate(map[string]any{})
+		var schemaErr *SchemaError
+		if !errors.As(err, &schemaErr) {
+			t.Fatalf("expected *SchemaError, got %v", err)
+		}
+		assert.Equal(t, "/", schemaErr.Violations[0].Path)
+	})
+}
+
+func TestSchemaApplyDefaults(t *testing.T) {
+	schema, err := LoadSchema(writeSchema(t, "values.schema.json", testSchema))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	vals := map[string]any{
+		"app": map[string]any{"name": "web"},
+	}
+	schema.ApplyDefaults(vals)
+
+	expected := map[string]any{
+		"app":   map[string]any{"name": "web", "replicas": 1},
+		"image": map[string]any{"repository": "nginx", "tag": "latest"},
+	}
+	assert.Equal(t, expected, vals)
+	assert.NoError(t, schema.Validate(vals))
+}
+
+func TestLoadSchemaYAML(t *testing.T) {
+	schema, err := LoadSchema(writeSchema(t, "values.schema.yaml", `
+type: object
+properties:
+  port:
+    type: integer
+`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+	assert.NoError(t, schema.Validate(map[string]any{"port": 8080}))
+	assert.Error(t, schema.Validate(map[string]any{"port": "8080"}))
+}
+
+func TestLoadSchemaErrors(t *testing.T) {
+	_, err := LoadSchema("nonexistent.schema.json")
+	assert.Error(t, err)
+
+	_, err = LoadSchema(writeSchema(t, "invalid.schema.json", `{"type": 42}`))
+	assert.Error(t, err)
+}
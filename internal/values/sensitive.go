@@ -0,0 +1,277 @@
+package values
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces sensitive values in logs and diagnostics.
+const Redacted = "[REDACTED]"
+
+// SecretTag marks a value in a values file as sensitive, e.g. "password: !secret hunter2".
+const SecretTag = "!secret"
+
+// DefaultSensitiveKeys are the key patterns whose values are always treated
+// as sensitive. Patterns are matched case-insensitively against key names.
+var DefaultSensitiveKeys = []string{
+	"*password*",
+	"*passwd*",
+	"*secret*",
+	"*token*",
+	"*apikey*",
+	"*api_key*",
+	"*private_key*",
+	"*privatekey*",
+	"*credential*",
+}
+
+// listElement is the key path segment for the elements of a list.
+const listElement = "[]"
+
+var (
+	sensitiveMu sync.RWMutex
+	// sensitiveValues holds the secret strings scrubbed from free text
+	sensitiveValues = map[string]bool{}
+	// sensitivePaths holds the key paths whose values are redacted
+	sensitivePaths = map[string]bool{}
+	// sensitiveKeys holds the key patterns added with SetSensitiveKeys
+	sensitiveKeys []string
+)
+
+// SetSensitiveKeys sets the key patterns whose values are treated as
+// sensitive in addition to DefaultSensitiveKeys, e.g. from --sensitive-key.
+func SetSensitiveKeys(patterns []string) {
+	sensitiveMu.Lock()
+	defer sensitiveMu.Unlock()
+	sensitiveKeys = append([]string{}, patterns...)
+}
+
+// sensitiveKeyPatterns returns DefaultSensitiveKeys and the patterns set
+// with SetSensitiveKeys.
+func sensitiveKeyPatterns() []string {
+	sensitiveMu.RLock()
+	defer sensitiveMu.RUnlock()
+	return append(append([]string{}, DefaultSensitiveKeys...), sensitiveKeys...)
+}
+
+// pathKey returns the registry key for a key path.
+func pathKey(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+// MarkSensitive registers the non-empty strings inside v as secrets, so they
+// are replaced by Redacted wherever templar logs them, however short they
+// are. Bools and numbers are ignored; use MarkSensitivePath to redact them by
+// key path.
+func MarkSensitive(v any) {
+	sensitiveMu.Lock()
+	defer sensitiveMu.Unlock()
+	markSensitive(v)
+}
+
+func markSensitive(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, value := range v {
+			markSensitive(value)
+		}
+	case []any:
+		for _, value := range v {
+			markSensitive(value)
+		}
+	case string:
+		if v != "" {
+			sensitiveValues[v] = true
+		}
+	}
+}
+
+// MarkSensitivePath marks the value at a key path as sensitive: everything
+// below the path is redacted by Redact and the strings in v are registered
+// like MarkSensitive does. List elements are addressed with "[]".
+func MarkSensitivePath(path []string, v any) {
+	sensitiveMu.Lock()
+	defer sensitiveMu.Unlock()
+	sensitivePaths[pathKey(path)] = true
+	markSensitive(v)
+}
+
+// IsSensitive reports whether v is a string registered as a secret.
+func IsSensitive(v any) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	sensitiveMu.RLock()
+	defer sensitiveMu.RUnlock()
+	return sensitiveValues[s]
+}
+
+// isSensitivePath reports whether path has been marked sensitive.
+func isSensitivePath(path []string) bool {
+	sensitiveMu.RLock()
+	defer sensitiveMu.RUnlock()
+	return sensitivePaths[pathKey(path)]
+}
+
+// resetSensitive forgets all sensitive values, paths and key patterns.
+func resetSensitive() {
+	sensitiveMu.Lock()
+	defer sensitiveMu.Unlock()
+	sensitiveValues = map[string]bool{}
+	sensitivePaths = map[string]bool{}
+	sensitiveKeys = nil
+}
+
+// Redact returns a deep copy of v with every sensitive scalar replaced by
+// Redacted. Scalars are sensitive if they are registered secrets, or if
+// they are below a key path marked sensitive or a key matching
+// DefaultSensitiveKeys or a pattern set with SetSensitiveKeys. v is treated
+// as the root of the values.
+func Redact(v any) any {
+	return redact(v, nil, sensitiveKeyPatterns(), false)
+}
+
+func redact(v any, path []string, patterns []string, sensitive bool) any {
+	if !sensitive && len(path) > 0 {
+		sensitive = isSensitivePath(path) ||
+			(path[len(path)-1] != listElement && isSensitiveKey(path[len(path)-1], patterns))
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		if v == nil {
+			return v
+		}
+		c := make(map[string]any, len(v))
+		for key, value := range v {
+			c[key] = redact(value, append(path[:len(path):len(path)], key), patterns, sensitive)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, value := range v {
+			c[i] = redact(value, append(path[:len(path):len(path)], listElement), patterns, sensitive)
+		}
+		return c
+	case nil:
+		return nil
+	default:
+		if sensitive || IsSensitive(v) {
+			return Redacted
+		}
+		return v
+	}
+}
+
+// RedactString replaces every occurrence of a registered secret in s.
+func RedactString(s string) string {
+	sensitiveMu.RLock()
+	secrets := make([]string, 0, len(sensitiveValues))
+	for secret := range sensitiveValues {
+		secrets = append(secrets, secret)
+	}
+	sensitiveMu.RUnlock()
+
+	// Replace longer secrets first so a secret containing another is fully hidden
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return s
+}
+
+// MarkSensitiveKeys registers the strings below all keys in vals matching
+// DefaultSensitiveKeys or a pattern set with SetSensitiveKeys as secrets.
+// Redact matches the key patterns itself.
+func MarkSensitiveKeys(vals map[string]any) {
+	patterns := sensitiveKeyPatterns()
+	sensitiveMu.Lock()
+	defer sensitiveMu.Unlock()
+	markSensitiveKeys(vals, patterns)
+}
+
+func markSensitiveKeys(v any, patterns []string) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if isSensitiveKey(key, patterns) {
+				markSensitive(value)
+				continue
+			}
+			markSensitiveKeys(value, patterns)
+		}
+	case []any:
+		for _, value := range v {
+			markSensitiveKeys(value, patterns)
+		}
+	}
+}
+
+func isSensitiveKey(key string, patterns []string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// unmarshalWithSecrets parses YAML like yaml.Unmarshal, marking the key
+// path of every value tagged with SecretTag as sensitive.
+func unmarshalWithSecrets(data []byte, out *map[string]any) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	var secrets []secretNode
+	collectSecretNodes(&doc, nil, &secrets)
+	if err := doc.Decode(out); err != nil {
+		return err
+	}
+	for _, secret := range secrets {
+		var value any
+		if err := secret.node.Decode(&value); err != nil {
+			return err
+		}
+		MarkSensitivePath(secret.path, value)
+	}
+	return nil
+}
+
+// secretNode is a node tagged with SecretTag and its key path.
+type secretNode struct {
+	node *yaml.Node
+	path []string
+}
+
+// collectSecretNodes finds nodes tagged with SecretTag and removes the tag so
+// they resolve like untagged values.
+func collectSecretNodes(node *yaml.Node, path []string, secrets *[]secretNode) {
+	if node.Tag == SecretTag {
+		node.Tag = ""
+		node.Style &^= yaml.TaggedStyle
+		*secrets = append(*secrets, secretNode{node: node, path: path})
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			collectSecretNodes(node.Content[i+1], append(path[:len(path):len(path)], node.Content[i].Value), secrets)
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			collectSecretNodes(child, append(path[:len(path):len(path)], listElement), secrets)
+		}
+	default:
+		for _, child := range node.Content {
+			collectSecretNodes(child, path, secrets)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package values
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	t.Cleanup(resetSensitive)
+	MarkSensitive(map[string]any{"list": []any{"tok-abc-123"}})
+	MarkSensitivePath([]string{"db", "pin"}, 1234)
+
+	input := map[string]any{
+		"db": map[string]any{
+			"password": "short",
+			"user":     "operator",
+			"pin":      1234,
+			"port":     1234,
+		},
+		"keys":  []any{"tok-abc-123", "public"},
+		"debug": true,
+	}
+	expected := map[string]any{
+		"db": map[string]any{
+			"password": Redacted,
+			"user":     "operator",
+			"pin":      Redacted,
+			"port":     1234,
+		},
+		"keys":  []any{Redacted, "public"},
+		"debug": true,
+	}
+	assert.Equal(t, expected, Redact(input))
+	assert.Equal(t, "short", input["db"].(map[string]any)["password"], "input must not be modified")
+	assert.Nil(t, Redact(map[string]any(nil)))
+}
+
+func TestRedactIgnoresNonStringValues(t *testing.T) {
+	t.Cleanup(resetSensitive)
+	vals := map[string]any{"tokenEnabled": true, "apiToken": "1234", "secretPort": 5432, "debug": true}
+	MarkSensitiveKeys(vals)
+	MarkSensitive(map[string]any{"flag": true, "pin": "42", "empty": ""})
+
+	assert.False(t, IsSensitive(true))
+	assert.False(t, IsSensitive(""))
+	assert.True(t, IsSensitive("1234"), "short strings marked sensitive are registered")
+	assert.True(t, IsSensitive("42"))
+	assert.Equal(t, "tls enabled: true, strict=true, port 5432", RedactString("tls enabled: true, strict=true, port 5432"))
+	assert.Equal(t, map[string]any{"tokenEnabled": Redacted, "apiToken": Redacted, "secretPort": Redacted, "debug": true}, Redact(vals))
+}
+
+func TestRedactString(t *testing.T) {
+	t.Cleanup(resetSensitive)
+	MarkSensitive("hunter2-longer")
+	MarkSensitive("4711")
+
+	assert.Equal(t, "password=[REDACTED] pin=[REDACTED]", RedactString("password=hunter2-longer pin=4711"))
+}
+
+func TestMarkSensitiveKeys(t *testing.T) {
+	t.Cleanup(resetSensitive)
+	SetSensitiveKeys([]string{"*_pin"})
+
+	vals := map[string]any{
+		"db": map[string]any{
+			"adminPassword": "pw-by-key-pattern",
+			"host":          "db.example.com",
+		},
+		"GITHUB_TOKEN": "gh-token-by-pattern",
+		"card_pin":     "pin-by-custom-pattern",
+		"credentials": map[string]any{
+			"user": "nested-under-sensitive-key",
+		},
+	}
+	MarkSensitiveKeys(vals)
+
+	assert.True(t, IsSensitive("pw-by-key-pattern"))
+	assert.True(t, IsSensitive("gh-token-by-pattern"))
+	assert.True(t, IsSensitive("pin-by-custom-pattern"))
+	assert.True(t, IsSensitive("nested-under-sensitive-key"))
+	assert.False(t, IsSensitive("db.example.com"))
+}
+
+func TestLoadAndMergeSecretTag(t *testing.T) {
+	t.Cleanup(resetSensitive)
+	file := filepath.Join(t.TempDir(), "values.yaml")
+	err := os.WriteFile(file, []byte(`
+db:
+  host: db.example.com
+  port: !secret 6543
+  auth: !secret
+    user: tagged-user
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	result, err := LoadAndMerge([]string{file}, nil, nil, nil, nil, LoadOptions{})
+	if err != nil {
+		t.Fatalf("LoadAndMerge failed: %v", err)
+	}
+	expected := map[string]any{
+		"db": map[string]any{
+			"host": "db.example.com",
+			"port": 6543,
+			"auth": map[string]any{"user": "tagged-user"},
+		},
+	}
+	assert.Equal(t, expected, result)
+	assert.False(t, IsSensitive(6543), "numbers are only redacted by key path")
+	assert.True(t, IsSensitive("tagged-user"))
+	assert.False(t, IsSensitive("db.example.com"))
+	redacted := map[string]any{
+		"db": map[string]any{
+			"host": "db.example.com",
+			"port": Redacted,
+			"auth": map[string]any{"user": Redacted},
+		},
+		"port": 6543,
+	}
+	result["port"] = 6543
+	assert.Equal(t, redacted, Redact(result))
+}
+
+func TestLoadAndMergeParseErrorOmitsContent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "values.yaml")
+	if err := os.WriteFile(file, []byte("password: leaked-in-error\ninvalid: [unclosed\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	_, err := LoadAndMerge([]string{file}, nil, nil, nil, nil, LoadOptions{})
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "leaked-in-error")
+	}
+}
+
+func TestSchemaMarkSensitive(t *testing.T) {
+	t.Cleanup(resetSensitive)
+	schema, err := LoadSchema(writeSchema(t, "values.schema.json", `{
+  "type": "object",
+  "properties": {
+    "license": {"type": "string", "secret": true},
+    "users": {"type": "array", "items": {"type": "object", "properties": {"pin": {"secret": true}}}}
+  }
+}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+	vals := map[string]any{
+		"license": "schema-marked-license",
+		"users":   []any{map[string]any{"name": "schema-user", "pin": 1234}},
+	}
+	schema.MarkSensitive(vals)
+	assert.True(t, IsSensitive("schema-marked-license"))
+	assert.False(t, IsSensitive("schema-user"))
+	assert.Equal(t, map[string]any{
+		"license": Redacted,
+		"users":   []any{map[string]any{"name": "schema-user", "pin": Redacted}},
+	}, Redact(vals))
+}
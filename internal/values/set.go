@@ -0,0 +1,238 @@
+package values
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxListIndex guards against a typo like "a[99999999]=x" allocating a huge list.
+const maxListIndex = 65536
+
+// pathSegment is a single step of a --set key path, either a map key or a list index.
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseKeyPath splits a --set key like "a.b[0].c" into its segments.
+// A backslash escapes the following character, so "a\.b" addresses the key "a.b".
+func parseKeyPath(key string) ([]pathSegment, error) {
+	var segments []pathSegment
+	var current strings.Builder
+	inKey := true       // the next characters belong to a key segment
+	afterIndex := false // the previous segment was a list index
+
+	flushKey := func() error {
+		if current.Len() == 0 {
+			return fmt.Errorf("empty key segment in %q", key)
+		}
+		segments = append(segments, pathSegment{key: current.String()})
+		current.Reset()
+		return nil
+	}
+
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if afterIndex && c != '.' && c != '[' {
+			return nil, fmt.Errorf("unexpected %q after list index in %q", c, key)
+		}
+		switch c {
+		case '\\':
+			if i+1 >= len(key) {
+				return nil, fmt.Errorf("trailing escape character in %q", key)
+			}
+			i++
+			current.WriteByte(key[i])
+		case '.':
+			if !afterIndex {
+				if err := flushKey(); err != nil {
+					return nil, err
+				}
+			}
+			inKey = true
+			afterIndex = false
+		case '[':
+			if inKey {
+				if err := flushKey(); err != nil {
+					return nil, err
+				}
+			}
+			end := strings.IndexByte(key[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated list index in %q", key)
+			}
+			raw := key[i+1 : i+end]
+			index, err := strconv.Atoi(raw)
+			if err != nil || index < 0 || strings.HasPrefix(raw, "+") {
+				return nil, fmt.Errorf("invalid list index %q in %q", raw, key)
+			}
+			if index > maxListIndex {
+				return nil, fmt.Errorf("list index %d in %q exceeds maximum of %d", index, key, maxListIndex)
+			}
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+			i += end
+			inKey = false
+			afterIndex = true
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if inKey {
+		if err := flushKey(); err != nil {
+			return nil, err
+		}
+	}
+	return segments, nil
+}
+
+// setPath stores value at the given path below curr, creating maps and
+// growing lists as needed, and returns the (possibly new) container.
+func setPath(curr any, segments []pathSegment, value any) any {
+	if len(segments) == 0 {
+		return value
+	}
+	seg := segments[0]
+	if seg.isIndex {
+		list, _ := curr.([]any)
+		if seg.index >= len(list) {
+			list = append(list, make([]any, seg.index-len(list)+1)...)
+		}
+		list[seg.index] = setPath(list[seg.index], segments[1:], value)
+		return list
+	}
+	m, ok := curr.(map[string]any)
+	if !ok {
+		m = map[string]any{}
+	}
+	m[seg.key] = setPath(m[seg.key], segments[1:], value)
+	return m
+}
+
+// setNestedValue sets value in m at a key path such as "app.name",
+// "app.ports[0].name" or "annotations.app\.kubernetes\.io/name".
+func setNestedValue(m map[string]any, key string, value any) error {
+	segments, err := parseKeyPath(key)
+	if err != nil {
+		return err
+	}
+	setPath(m, segments, value)
+	return nil
+}
+
+// Lookup returns the value at a key path such as "app.ports[0].name" in v,
+// using the same syntax as --set. ok is false if the path does not exist.
+func Lookup(v any, key string) (value any, ok bool, err error) {
+	segments, err := parseKeyPath(key)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, seg := range segments {
+		if seg.isIndex {
+			rv := reflect.ValueOf(v)
+			if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || seg.index >= rv.Len() {
+				return nil, false, nil
+			}
+			v = rv.Index(seg.index).Interface()
+			continue
+		}
+		switch m := v.(type) {
+		case map[string]any:
+			if v, ok = m[seg.key]; !ok {
+				return nil, false, nil
+			}
+		default:
+			rv := reflect.ValueOf(v)
+			if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+				return nil, false, nil
+			}
+			elem := rv.MapIndex(reflect.ValueOf(seg.key).Convert(rv.Type().Key()))
+			if !elem.IsValid() {
+				return nil, false, nil
+			}
+			v = elem.Interface()
+		}
+	}
+	return v, true, nil
+}
+
+// splitSetValue splits a "key=value" flag value.
+func splitSetValue(flag, setVal string) (string, string, error) {
+	parts := strings.SplitN(setVal, "=", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("%s must be in key=value format", flag)
+	}
+	return parts[0], parts[1], nil
+}
+
+// applySet applies --set values, resolving each value as a YAML scalar.
+func applySet(dst map[string]any, setVals []string) error {
+	for _, setVal := range setVals {
+		key, value, err := splitSetValue("--set", setVal)
+		if err != nil {
+			return err
+		}
+		parsed, err := parseYAMLValue(value)
+		if err != nil {
+			return fmt.Errorf("invalid --set value for %s: %w", key, err)
+		}
+		if err := setNestedValue(dst, key, parsed); err != nil {
+			return fmt.Errorf("invalid --set key: %w", err)
+		}
+	}
+	return nil
+}
+
+// applySetString applies --set-string values, always storing them as strings.
+func applySetString(dst map[string]any, setVals []string) error {
+	for _, setVal := range setVals {
+		key, value, err := splitSetValue("--set-string", setVal)
+		if err != nil {
+			return err
+		}
+		if err := setNestedValue(dst, key, value); err != nil {
+			return fmt.Errorf("invalid --set-string key: %w", err)
+		}
+	}
+	return nil
+}
+
+// applySetFile applies --set-file values, storing the contents of the named file.
+func applySetFile(dst map[string]any, setVals []string) error {
+	for _, setVal := range setVals {
+		key, path, err := splitSetValue("--set-file", setVal)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read --set-file %s: %w", path, err)
+		}
+		if err := setNestedValue(dst, key, string(data)); err != nil {
+			return fmt.Errorf("invalid --set-file key: %w", err)
+		}
+	}
+	return nil
+}
+
+// applySetJSON applies --set-json values, decoding each value as JSON.
+func applySetJSON(dst map[string]any, setVals []string) error {
+	for _, setVal := range setVals {
+		key, value, err := splitSetValue("--set-json", setVal)
+		if err != nil {
+			return err
+		}
+		var parsed any
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			return fmt.Errorf("invalid JSON for --set-json %s: %w", key, err)
+		}
+		if err := setNestedValue(dst, key, parsed); err != nil {
+			return fmt.Errorf("invalid --set-json key: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package values
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeyPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		key         string
+		expected    []pathSegment
+		expectError bool
+	}{
+		{
+			name:     "Simple key",
+			key:      "app",
+			expected: []pathSegment{{key: "app"}},
+		},
+		{
+			name:     "Nested keys",
+			key:      "app.name",
+			expected: []pathSegment{{key: "app"}, {key: "name"}},
+		},
+		{
+			name: "List index",
+			key:  "app.ports[1].name",
+			expected: []pathSegment{
+				{key: "app"}, {key: "ports"}, {index: 1, isIndex: true}, {key: "name"},
+			},
+		},
+		{
+			name: "Nested list index",
+			key:  "matrix[0][2]",
+			expected: []pathSegment{
+				{key: "matrix"}, {index: 0, isIndex: true}, {index: 2, isIndex: true},
+			},
+		},
+		{
+			name:     "Escaped dots",
+			key:      `annotations.app\.kubernetes\.io/name`,
+			expected: []pathSegment{{key: "annotations"}, {key: "app.kubernetes.io/name"}},
+		},
+		{
+			name:     "Escaped bracket",
+			key:      `a\[0]`,
+			expected: []pathSegment{{key: "a[0]"}},
+		},
+		{name: "Empty key", key: "", expectError: true},
+		{name: "Empty segment", key: "a..b", expectError: true},
+		{name: "Trailing dot", key: "a.", expectError: true},
+		{name: "Leading index", key: "[0].a", expectError: true},
+		{name: "Negative index", key: "a[-1]", expectError: true},
+		{name: "Non-numeric index", key: "a[x]", expectError: true},
+		{name: "Unterminated index", key: "a[0", expectError: true},
+		{name: "Text after index", key: "a[0]b", expectError: true},
+		{name: "Index too large", key: "a[99999999]", expectError: true},
+		{name: "Trailing escape", key: `a\`, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseKeyPath(tt.key)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSetNestedValue(t *testing.T) {
+	m := map[string]any{
+		"app": map[string]any{
+			"ports": []any{
+				map[string]any{"name": "http", "port": 80},
+			},
+		},
+	}
+
+	assert.NoError(t, setNestedValue(m, "app.ports[0].port", 8080))
+	assert.NoError(t, setNestedValue(m, "app.ports[2].name", "grpc"))
+	assert.NoError(t, setNestedValue(m, `labels.app\.kubernetes\.io/name`, "web"))
+	assert.NoError(t, setNestedValue(m, "list[1]", "b"))
+
+	expected := map[string]any{
+		"app": map[string]any{
+			"ports": []any{
+				map[string]any{"name": "http", "port": 8080},
+				nil,
+				map[string]any{"name": "grpc"},
+			},
+		},
+		"labels": map[string]any{
+			"app.kubernetes.io/name": "web",
+		},
+		"list": []any{nil, "b"},
+	}
+	assert.Equal(t, expected, m)
+}
+
+func TestLoadAndMergeSetVariants(t *testing.T) {
+	tempDir := t.TempDir()
+	certFile := filepath.Join(tempDir, "cert.pem")
+	if err := os.WriteFile(certFile, []byte("-----BEGIN CERTIFICATE-----\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	result, err := LoadAndMerge(nil,
+		[]string{"app.replicas=3", "app.env[0].value=override"},
+		[]string{"app.version=1.10", "app.replicas=5", "app.tags=a,b"},
+		[]string{"app.tls.cert=" + certFile},
+		[]string{`app.env=[{"name":"A","value":"a"},{"name":"B","value":"b"}]`},
+		LoadOptions{})
+	if err != nil {
+		t.Fatalf("LoadAndMerge failed: %v", err)
+	}
+
+	expected := map[string]any{
+		"app": map[string]any{
+			"replicas": "5",
+			"version":  "1.10",
+			"tags":     "a,b",
+			"env": []any{
+				map[string]any{"name": "A", "value": "override"},
+				map[string]any{"name": "B", "value": "b"},
+			},
+			"tls": map[string]any{
+				"cert": "-----BEGIN CERTIFICATE-----\n",
+			},
+		},
+	}
+	assert.Equal(t, expected, result)
+}
+
+func TestLoadAndMergeSetVariantErrors(t *testing.T) {
+	_, err := LoadAndMerge(nil, nil, nil, []string{"key=/nonexistent/file"}, nil, LoadOptions{})
+	assert.Error(t, err)
+
+	_, err = LoadAndMerge(nil, nil, nil, nil, []string{"key={invalid"}, LoadOptions{})
+	assert.Error(t, err)
+
+	_, err = LoadAndMerge(nil, []string{"a..b=1"}, nil, nil, nil, LoadOptions{})
+	assert.Error(t, err)
+
+	_, err = LoadAndMerge(nil, nil, []string{"novalue"}, nil, nil, LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLookup(t *testing.T) {
+	vals := map[string]any{
+		"app": map[string]any{
+			"ports":  []any{map[string]any{"name": "http", "port": 80}},
+			"labels": map[string]string{"app.kubernetes.io/name": "web"},
+		},
+		"empty": nil,
+	}
+	tests := []struct {
+		key      string
+		expected any
+		ok       bool
+		err      bool
+	}{
+		{key: "app.ports[0].name", expected: "http", ok: true},
+		{key: "app.ports[0]", expected: map[string]any{"name": "http", "port": 80}, ok: true},
+		{key: `app.labels.app\.kubernetes\.io/name`, expected: "web", ok: true},
+		{key: "empty", expected: nil, ok: true},
+		{key: "app.ports[1].name"},
+		{key: "app.missing"},
+		{key: "app.ports.name"},
+		{key: "app..ports", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			value, ok, err := Lookup(vals, tt.key)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, value)
+		})
+	}
+}
@@ -4,15 +4,34 @@ import (
 	"fmt"
 	"os"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
-var envVarRegexp = regexp.MustCompile(`\$\{([^}]+)\}`)
+var leadingZeroRegexp = regexp.MustCompile(`^[-+]?0[0-9_]+$`)
 
-func LoadAndMerge(valueFiles []string, setVals []string) (map[string]any, error) {
+// supportedTags are the explicit type tags accepted in --set values.
+var supportedTags = map[string]bool{
+	"!!str":   true,
+	"!!int":   true,
+	"!!float": true,
+	"!!bool":  true,
+	"!!null":  true,
+}
+
+// LoadOptions configures how LoadAndMerge reads values files.
+type LoadOptions struct {
+	// NoEnvSubst disables the substitution of environment variables
+	NoEnvSubst bool
+	// AgeKeyFile is an age identity file for encrypted values files, in
+	// addition to the TEMPLAR_AGE_KEY(_FILE) and SOPS_AGE_KEY(_FILE) variables
+	AgeKeyFile string
+}
+
+// LoadAndMerge loads the given values files in order and applies the
+// --set-json, --set, --set-string and --set-file overrides on top of them.
+func LoadAndMerge(valueFiles, setVals, setStringVals, setFileVals, setJSONVals []string, opts LoadOptions) (map[string]any, error) {
 	final := map[string]any{}
 
 	// Load values from files
@@ -22,48 +41,50 @@ func LoadAndMerge(valueFiles []string, setVals []string) (map[string]any, error)
 			return nil, fmt.Errorf("failed to read values file %s: %w", file, err)
 		}
 
+		// Encrypted files are decrypted and parsed as-is
+		decrypted, encrypted, err := decryptValuesFile(file, data, opts.AgeKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if encrypted {
+			MergeMaps(final, decrypted)
+			continue
+		}
+
 		// Substitute environment variables before parsing
-		yamlText := SubstituteEnvVars(string(data))
+		yamlText := string(data)
+		if !opts.NoEnvSubst {
+			yamlText, err = SubstituteEnvVars(yamlText)
+			if err != nil {
+				return nil, fmt.Errorf("failed to substitute environment variables in %s: %w", file, err)
+			}
+		}
 
 		var parsed map[string]any
-		if err := yaml.Unmarshal([]byte(yamlText), &parsed); err != nil {
-			return nil, fmt.Errorf("invalid YAML in file %s: %w :: \n%s", file, err, yamlText)
+		if err := unmarshalWithSecrets([]byte(yamlText), &parsed); err != nil {
+			return nil, fmt.Errorf("invalid YAML in file %s: %w", file, err)
 		}
 
 		MergeMaps(final, parsed)
 	}
 
-	// Merge --set values
-	for _, setVal := range setVals {
-		parts := strings.SplitN(setVal, "=", 2)
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("--set must be in key=value format")
-		}
-		setNestedValue(final, parts[0], parts[1])
+	// Merge --set style values
+	if err := applySetJSON(final, setJSONVals); err != nil {
+		return nil, err
+	}
+	if err := applySet(final, setVals); err != nil {
+		return nil, err
+	}
+	if err := applySetString(final, setStringVals); err != nil {
+		return nil, err
+	}
+	if err := applySetFile(final, setFileVals); err != nil {
+		return nil, err
 	}
 
-	return final, nil
-}
-
-// Support nested keys like "app.name=foo"
-func setNestedValue(m map[string]any, key string, value string) {
-	keys := strings.Split(key, ".")
-	last := len(keys) - 1
+	MarkSensitiveKeys(final)
 
-	curr := m
-	for i, k := range keys {
-		if i == last {
-			curr[k] = parseYAMLValue(value)
-			return
-		}
-		if next, ok := curr[k].(map[string]any); ok {
-			curr = next
-		} else {
-			next := make(map[string]any)
-			curr[k] = next
-			curr = next
-		}
-	}
+	return final, nil
 }
 
 // Merge src into dst
@@ -81,71 +102,46 @@ func MergeMaps(dst, src map[string]any) {
 	}
 }
 
-// SubstituteEnvVars replaces ${VAR} with the corresponding environment variable.
-// Escaped form ${{VAR}} is preserved as literal ${VAR}.
-func SubstituteEnvVars(yamlContent string) string {
-	// Escape ${{VAR}} to a temporary placeholder
-	yamlContent = strings.ReplaceAll(yamlContent, "${{", "__ESCAPED_VAR__START__")
-	yamlContent = strings.ReplaceAll(yamlContent, "}}", "__ESCAPED_VAR__END__")
-
-	// Substitute all ${VAR}
-	yamlContent = envVarRegexp.ReplaceAllStringFunc(yamlContent, func(m string) string {
-		key := envVarRegexp.FindStringSubmatch(m)[1]
-		value := os.Getenv(key)
-		// Check for integers
-		if _, err := strconv.Atoi(value); err == nil && strings.HasPrefix(value, "0") {
-			return fmt.Sprintf("\"%s\"", value)
+// parseYAMLValue resolves a --set value the same way the YAML 1.2 resolver used
+// for values files resolves a plain scalar. An explicit tag prefix such as
+// "!!str 0123" or "!!int 42" forces the type. Integers with leading zeros are
+// the one deliberate difference: yaml.v3 resolves "0755" to 493 and
+// "01914634" to a float, but they are kept as strings here since they are
+// usually identifiers (zip codes, account numbers) and would lose their zeros.
+// "{a, b}" is a list of resolved values, and "{}" an empty map as in YAML.
+func parseYAMLValue(value string) (any, error) {
+	node := yaml.Node{Kind: yaml.ScalarNode, Value: value}
+
+	if strings.HasPrefix(value, "!!") {
+		tag, rest, _ := strings.Cut(value, " ")
+		if !supportedTags[tag] {
+			return nil, fmt.Errorf("unsupported type tag %s in value %q", tag, value)
 		}
-
-		return value
-	})
-
-	// Restore escaped ${VAR}
-	yamlContent = strings.ReplaceAll(yamlContent, "__ESCAPED_VAR__START__", "${")
-	yamlContent = strings.ReplaceAll(yamlContent, "__ESCAPED_VAR__END__", "}")
-
-	return yamlContent
-}
-
-func parseYAMLValue(value string) any {
-	// Check for booleans
-	if value == "true" || value == "True" {
-		return true
-	}
-	if value == "false" || value == "False" {
-		return false
-	}
-
-	// Check for null
-	if value == "null" || value == "~" {
-		return nil
-	}
-
-	// Check for leading zeroes
-	if strings.HasPrefix(value, "0") {
-		return value
-	}
-
-	// Check for integers
-	if intVal, err := strconv.Atoi(value); err == nil {
-		return intVal
-	}
-
-	// Check for floats
-	if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
-		return floatVal
-	}
-
-	// Check for lists
-	if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+		node.Tag = tag
+		node.Value = rest
+	} else if leadingZeroRegexp.MatchString(value) {
+		return value, nil
+	} else if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+		// Check for lists
 		trimmed := strings.Trim(value, "{}")
+		if strings.TrimSpace(trimmed) == "" {
+			return map[string]any{}, nil
+		}
 		parts := strings.Split(trimmed, ",")
+		list := make([]any, len(parts))
 		for i := range parts {
-			parts[i] = strings.TrimSpace(parts[i])
+			item, err := parseYAMLValue(strings.TrimSpace(parts[i]))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
 		}
-		return parts
+		return list, nil
 	}
 
-	// Default to string
-	return value
+	var parsed any
+	if err := node.Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("invalid value %q: %w", value, err)
+	}
+	return parsed, nil
 }
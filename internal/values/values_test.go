@@ -1,9 +1,12 @@
 package values
 
 import (
+	"math"
 	"os"
 	"reflect"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestLoadAndMerge(t *testing.T) {
@@ -49,7 +52,7 @@ config:
 		// Call LoadAndMerge
 		valueFiles := []string{file1, file2, file3}
 		setVals := []string{"app.name=overridden-app", "app.newKey=newValue", "app.tag=01914634"}
-		result, err := LoadAndMerge(valueFiles, setVals)
+		result, err := LoadAndMerge(valueFiles, setVals, nil, nil, nil, LoadOptions{})
 		if err != nil {
 			t.Fatalf("LoadAndMerge failed: %v", err)
 		}
@@ -88,23 +91,118 @@ app:
 			t.Fatalf("Failed to create test file: %v", err)
 		}
 
-		_, err = LoadAndMerge([]string{invalidFile}, nil)
+		_, err = LoadAndMerge([]string{invalidFile}, nil, nil, nil, nil, LoadOptions{})
 		if err == nil {
 			t.Fatal("Expected error for invalid YAML, got nil")
 		}
 	})
 
 	t.Run("Handle missing file", func(t *testing.T) {
-		_, err := LoadAndMerge([]string{"nonexistent.yaml"}, nil)
+		_, err := LoadAndMerge([]string{"nonexistent.yaml"}, nil, nil, nil, nil, LoadOptions{})
 		if err == nil {
 			t.Fatal("Expected error for missing file, got nil")
 		}
 	})
 
 	t.Run("Handle invalid --set format", func(t *testing.T) {
-		_, err := LoadAndMerge(nil, []string{"invalidSetFormat"})
+		_, err := LoadAndMerge(nil, []string{"invalidSetFormat"}, nil, nil, nil, LoadOptions{})
 		if err == nil {
 			t.Fatal("Expected error for invalid --set format, got nil")
 		}
 	})
 }
+
+func TestParseYAMLValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		// Booleans and null follow the YAML 1.2 core schema
+		{"true", true},
+		{"True", true},
+		{"TRUE", true},
+		{"false", false},
+		{"yes", "yes"},
+		{"no", "no"},
+		{"null", nil},
+		{"~", nil},
+		{"", nil},
+		// Numbers
+		{"0", 0},
+		{"42", 42},
+		{"-7", -7},
+		{"1_000", 1000},
+		{"0x1F", 31},
+		{"0o17", 15},
+		{"0.5", 0.5},
+		{"1.0", 1.0},
+		{"1e3", 1000.0},
+		{"-.inf", math.Inf(-1)},
+		// Leading zeros are kept as strings
+		{"01914634", "01914634"},
+		{"0755", "0755"},
+		// Strings
+		{"hello", "hello"},
+		{"1.2.3", "1.2.3"},
+		// Explicit tags
+		{"!!str 0.5", "0.5"},
+		{"!!str true", "true"},
+		{"!!str", ""},
+		{"!!int 42", 42},
+		{"!!int 0o755", 493},
+		{"!!float 3", 3.0},
+		{"!!bool true", true},
+		{"!!null null", nil},
+		// Lists
+		{"{a, 1, true}", []any{"a", 1, true}},
+		{"{}", map[string]any{}},
+		{"{ }", map[string]any{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := parseYAMLValue(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Expected %#v, got %#v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("Consistent with values files", func(t *testing.T) {
+		// Leading zeros are the only inputs that deliberately differ
+		divergent := map[string]any{
+			"0755":     "0755",
+			"01914634": "01914634",
+		}
+		for _, input := range []string{"0.5", "1e3", "TRUE", "0x1F", "yes", "~", "0", "0o17", "0755", "01914634", "{}"} {
+			var fromFile map[string]any
+			if err := yaml.Unmarshal([]byte("key: "+input), &fromFile); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			result, err := parseYAMLValue(input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if expected, ok := divergent[input]; ok {
+				if reflect.DeepEqual(result, fromFile["key"]) || !reflect.DeepEqual(result, expected) {
+					t.Errorf("%q: values file gives %#v, --set gives %#v, expected %#v", input, fromFile["key"], result, expected)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(result, fromFile["key"]) {
+				t.Errorf("%q: values file gives %#v, --set gives %#v", input, fromFile["key"], result)
+			}
+		}
+	})
+
+	t.Run("Invalid tagged values", func(t *testing.T) {
+		for _, input := range []string{"!!int abc", "!!bool maybe", "!!map {}"} {
+			if _, err := parseYAMLValue(input); err == nil {
+				t.Errorf("expected error for %q, got nil", input)
+			}
+		}
+	})
+}
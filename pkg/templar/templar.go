@@ -0,0 +1,53 @@
+// Package templar lets programs built with Templar as a library add Go
+// functions to the functions available in templates, and render templates
+// with them.
+package templar
+
+import (
+	"io"
+	"path/filepath"
+	"templar/internal/tome"
+	"templar/internal/values"
+	"text/template"
+)
+
+// RegisterFunc adds a Go function to the functions available in templates.
+// fn must return one value, or a value and an error. It is meant to be
+// called from init functions, and fails if name is taken by a Sprig,
+// built-in or other registered function.
+func RegisterFunc(name string, fn any) error {
+	return tome.RegisterFunc(name, fn)
+}
+
+// RegisterFuncs adds every function of funcs, see RegisterFunc.
+func RegisterFuncs(funcs template.FuncMap) error {
+	return tome.RegisterFuncs(funcs)
+}
+
+// Template renders text with vals, the Sprig, built-in and registered
+// functions. Relative paths in file functions are resolved against the
+// current directory.
+func Template(w io.Writer, text string, vals map[string]any) error {
+	t := &tome.Tome{Source: ".", Values: copyValues(vals)}
+	return t.Template(w, text, "template")
+}
+
+// RenderFile renders the template file at path with vals to w, like the
+// templar command does for a single input file.
+func RenderFile(w io.Writer, path string, vals map[string]any) error {
+	t, err := tome.New(path, "", "", nil, nil, nil, nil, nil, copyValues(vals))
+	if err != nil {
+		return err
+	}
+	t.Roots = []string{filepath.Dir(path)}
+	return t.RenderFile(w, path, "")
+}
+
+// copyValues copies vals, so rendering never modifies the caller's map.
+func copyValues(vals map[string]any) map[string]any {
+	copied, _ := values.DeepCopy(vals).(map[string]any)
+	if copied == nil {
+		copied = map[string]any{}
+	}
+	return copied
+}
@@ -0,0 +1,44 @@
+package templar_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"templar/pkg/templar"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterFuncs(t *testing.T) {
+	assert.NoError(t, templar.RegisterFunc("triple", func(i int) int { return i * 3 }))
+	assert.NoError(t, templar.RegisterFuncs(template.FuncMap{"shout": strings.ToUpper}))
+
+	var b bytes.Buffer
+	if assert.NoError(t, templar.Template(&b, `{{ triple .n }} {{ shout "hi" }}`, map[string]any{"n": 14})) {
+		assert.Equal(t, "42 HI", b.String())
+	}
+
+	err := templar.RegisterFunc("triple", func() int { return 0 })
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "function triple is already defined")
+	}
+}
+
+func TestRenderFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte("name: {{ .name | upper }}\n"), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+	vals := map[string]any{"name": "web"}
+
+	var b bytes.Buffer
+	if assert.NoError(t, templar.RenderFile(&b, path, vals)) {
+		assert.Equal(t, "name: WEB\n", b.String())
+	}
+	assert.Equal(t, map[string]any{"name": "web"}, vals, "values must not be modified")
+
+	assert.Error(t, templar.RenderFile(&b, filepath.Join(t.TempDir(), "missing.yaml"), vals))
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -154,3 +155,29 @@ produced %s (%d):
 		}
 	}
 }
+
+func TestSingleFileValidatesOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	input := filepath.Join(tmpDir, "config.yaml.tpl")
+	if err := os.WriteFile(input, []byte("name: {{ .name }}\nlist: [{{ .item }}\n"), 0644); err != nil {
+		t.Fatal("failed to write input file:", err)
+	}
+
+	// Written to stdout, the format is taken from the input without the stripped suffix
+	out, err := exec.Command(templarBin, "--validate-output", "--strip=.tpl", "--set=name=web", "--set=item=a]", input).CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to run templar command: %v\n%s", err, out)
+	}
+	if want := "name: web\nlist: [a]\n"; string(out) != want {
+		t.Errorf("unexpected output %q, want %q", out, want)
+	}
+
+	output := filepath.Join(tmpDir, "config.yaml")
+	out, err = exec.Command(templarBin, "--validate-output", "--set=name=web", "--set=item=a", "--out="+output, input).CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected invalid output to fail, got:\n%s", out)
+	}
+	if !strings.Contains(string(out), "invalid output: "+output+":") {
+		t.Errorf("expected the invalid output to be reported, got:\n%s", out)
+	}
+}